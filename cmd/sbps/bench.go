@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/log"
+	"github.com/ssup2/sbps/pkg/res"
+	"github.com/ssup2/sbps/pkg/sbps"
+	"github.com/ssup2/sbps/pkg/server"
+)
+
+// Constants for benchmark
+const (
+	BenchText = "TEXT"
+	BenchJSON = "JSON"
+
+	BenchWarmup  = 500 * time.Millisecond
+	BenchGrace   = time.Second
+	BenchSamples = 10000
+	BenchMemTick = 500 * time.Millisecond
+)
+
+// BenchResult represents a result of a benchmark. Frames are counted by
+// their emission time in the measurement window, and drops and memory are
+// only measured with a local sbps.
+type BenchResult struct {
+	Target    string  `json:"target"`
+	Local     bool    `json:"local"`
+	Clients   int     `json:"clients"`
+	Resources int     `json:"resources,omitempty"`
+	Rate      float64 `json:"rate,omitempty"`
+	Size      int     `json:"size,omitempty"`
+	Duration  float64 `json:"durationSec"`
+
+	Frames    int64   `json:"frames"`
+	FrameRate float64 `json:"frameRate"`
+	ByteRate  float64 `json:"byteRate"`
+
+	Generated int64   `json:"generated,omitempty"`
+	Drops     int64   `json:"drops,omitempty"`
+	DropRatio float64 `json:"dropRatio,omitempty"`
+
+	LatencyP50 float64 `json:"latencyP50Ms"`
+	LatencyP90 float64 `json:"latencyP90Ms"`
+	LatencyP99 float64 `json:"latencyP99Ms"`
+	LatencyMax float64 `json:"latencyMaxMs"`
+
+	HeapAlloc  uint64 `json:"heapAlloc,omitempty"`
+	HeapPeak   uint64 `json:"heapPeak,omitempty"`
+	Sys        uint64 `json:"sys,omitempty"`
+	Goroutines int    `json:"goroutines,omitempty"`
+}
+
+// benchWindow represents the measurement window of a benchmark.
+type benchWindow struct {
+	start int64
+	end   int64
+}
+
+// in checks the time is in the window.
+func (w *benchWindow) in(t time.Time) bool {
+	ns := t.UnixNano()
+	start := atomic.LoadInt64(&w.start)
+	return start != 0 && ns >= start && ns < atomic.LoadInt64(&w.end)
+}
+
+// benchClient represents a simulated client which counts received frames
+// and samples broadcast latencies.
+type benchClient struct {
+	conn net.Conn
+
+	frames  int64
+	bytes   int64
+	seen    int64
+	samples []time.Duration
+	random  *rand.Rand
+}
+
+// getBenchTime parses the emission time of a TIME frame.
+func getBenchTime(b []byte) (time.Time, bool) {
+	i := bytes.IndexAny(b, " \n")
+	if i < 0 {
+		i = len(b)
+	}
+
+	ns, err := strconv.ParseInt(string(b[:i]), 10, 64)
+	if err != nil || ns <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// run reads frames until the connection is closed. Frames which are not
+// TIME frames are counted by the receive time without latency.
+func (c *benchClient) run(w *benchWindow) {
+	r := bufio.NewReaderSize(c.conn, 64*1024)
+	for {
+		frame, err := r.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+
+		now := time.Now()
+		t, isTime := getBenchTime(frame)
+		if !isTime {
+			t = now
+		}
+		if !w.in(t) {
+			continue
+		}
+
+		c.frames++
+		c.bytes += int64(len(frame))
+		if isTime {
+			c.sample(now.Sub(t))
+		}
+	}
+}
+
+// sample keeps a latency by reservoir sampling.
+func (c *benchClient) sample(d time.Duration) {
+	c.seen++
+	if len(c.samples) < BenchSamples {
+		c.samples = append(c.samples, d)
+		return
+	}
+	if i := c.random.Int63n(c.seen); i < BenchSamples {
+		c.samples[i] = d
+	}
+}
+
+// getBenchAddr returns the network and the address of a target
+// (TCP:host:port, UNIX:path).
+func getBenchAddr(target string) (string, string, error) {
+	split := strings.SplitN(target, ":", 2)
+	if len(split) != 2 || split[1] == "" {
+		return "", "", fmt.Errorf("Wrong target - %s", target)
+	}
+
+	switch split[0] {
+	case server.TypeTCP:
+		return "tcp", split[1], nil
+	case server.TypeUnix:
+		return "unix", split[1], nil
+	}
+	return "", "", fmt.Errorf("Wrong target - %s", target)
+}
+
+// getPercentile returns the percentile of sorted latencies in milliseconds.
+func getPercentile(samples []time.Duration, p float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	d := samples[int(p*float64(len(samples)-1))]
+	return float64(d) / float64(time.Millisecond)
+}
+
+// printBench prints a result of a benchmark.
+func printBench(result *BenchResult, format string) {
+	if format == BenchJSON {
+		b, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+
+	mib := func(b float64) float64 { return b / 1024 / 1024 }
+
+	fmt.Printf("sbps bench - %s - %d clients", result.Target, result.Clients)
+	if result.Local {
+		fmt.Printf(", %d resources, %g frames/s, %d bytes", result.Resources, result.Rate,
+			result.Size)
+	}
+	fmt.Printf(", %gs\n", result.Duration)
+	fmt.Printf("Throughput : %.0f frames/s, %.2f MiB/s (%d frames to all clients)\n",
+		result.FrameRate, mib(result.ByteRate), result.Frames)
+	if result.Local {
+		fmt.Printf("Drops      : %d (%.2f%% of %d generated frames to all clients)\n",
+			result.Drops, result.DropRatio*100, result.Generated*int64(result.Clients))
+	}
+	fmt.Printf("Latency    : p50 %.3fms, p90 %.3fms, p99 %.3fms, max %.3fms\n",
+		result.LatencyP50, result.LatencyP90, result.LatencyP99, result.LatencyMax)
+	if result.Local {
+		fmt.Printf("Memory     : heap %.1f MiB (peak %.1f MiB), sys %.1f MiB, goroutines %d\n",
+			mib(float64(result.HeapAlloc)), mib(float64(result.HeapPeak)),
+			mib(float64(result.Sys)), result.Goroutines)
+	}
+}
+
+// MainBench starts a local sbps with generated resources or targets a
+// running sbps, attaches simulated clients and reports throughput,
+// broadcast latency percentiles, drops and memory.
+func MainBench(args []string) {
+	// Options
+	flags := flag.NewFlagSet(CmdBench, flag.ExitOnError)
+	optTarget := flags.String("target", "",
+		"Running sbps to benchmark (option TCP:host:port, UNIX:path, empty means a local sbps)")
+	optMode := flags.String("mode", server.TypeTCP+":6070",
+		"Local sbps proxy server mode (option TCP:port, UNIX:path)")
+	optClients := flags.Int("clients", 10,
+		"Number of simulated clients")
+	optResources := flags.Int("resources", 1,
+		"Number of generated resources of a local sbps")
+	optRate := flags.Float64("rate", 1000,
+		"Frames per second of each generated resource (0 means no rate limit)")
+	optSize := flags.Int("size", 64,
+		"Bytes of a generated frame")
+	optDuration := flags.Duration("duration", 10*time.Second,
+		"Duration of measurement")
+	optFormat := flags.String("format", BenchText,
+		"Report format (option TEXT, JSON)")
+	optLogPath := flags.String("logpath", "./sbps.log",
+		"Log path")
+	optLogLevel := flags.String("loglevel", "WARN",
+		"Log level (option DEBUG, INFO, WARN, ERROR, CRIT)")
+	flags.Parse(args)
+
+	if *optClients <= 0 || *optResources <= 0 || *optRate < 0 || *optSize <= 0 ||
+		*optDuration <= 0 || (*optFormat != BenchText && *optFormat != BenchJSON) {
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Logger
+	logFormat := log.OptText
+	logError := log.Init(optLogPath, optLogLevel, &logFormat, nil, nil)
+	if logError != nil {
+		fmt.Fprintf(os.Stderr, "Init file logger failed - %s\n", logError.Error())
+		os.Exit(1)
+	}
+	defer log.Clean()
+
+	result := &BenchResult{
+		Target:   *optTarget,
+		Local:    strings.Compare(*optTarget, "") == 0,
+		Clients:  *optClients,
+		Duration: optDuration.Seconds(),
+	}
+	window := &benchWindow{}
+
+	// Local sbps
+	var proxy *sbps.Proxy
+	var generated int64
+	network, addr := "", ""
+	if result.Local {
+		ln, lnError := sbps.ParseListener(*optMode)
+		if lnError != nil {
+			fmt.Fprintf(os.Stderr, "Wrong mode option - %s\n", lnError.Error())
+			os.Exit(1)
+		}
+		result.Target = ln.String()
+		result.Resources = *optResources
+		result.Rate = *optRate
+		result.Size = *optSize
+
+		// Count generated frames in the window
+		counter := &res.InterceptorFuncs{
+			Read: func(h *res.Handler, b []byte) ([]byte, error) {
+				if t, ok := getBenchTime(b); ok && window.in(t) {
+					atomic.AddInt64(&generated, 1)
+				}
+				return b, nil
+			},
+		}
+
+		options := []sbps.Option{sbps.WithListener(ln), sbps.WithRetryInterval(0)}
+		pattern := res.GenTime + res.GenArgSeparator + strconv.Itoa(*optSize)
+		for i := 0; i < *optResources; i++ {
+			options = append(options, sbps.WithResource(
+				sbps.Gen{Pattern: pattern, Rate: *optRate}, sbps.ResInterceptor(counter)))
+		}
+
+		var proxyError error
+		proxy, proxyError = sbps.New(options...)
+		if proxyError != nil {
+			fmt.Fprintf(os.Stderr, "Allocation of a proxy failed - %s\n", proxyError.Error())
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go proxy.Run(ctx)
+
+		network, addr = "tcp", "127.0.0.1:"+ln.Addr
+		if ln.Type == server.TypeUnix {
+			network, addr = "unix", ln.Addr
+		}
+	} else {
+		var addrError error
+		network, addr, addrError = getBenchAddr(*optTarget)
+		if addrError != nil {
+			fmt.Fprintln(os.Stderr, addrError.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Clients
+	clients := make([]*benchClient, *optClients)
+	wg := &sync.WaitGroup{}
+	for i := range clients {
+		conn, dialError := net.Dial(network, addr)
+		if dialError != nil {
+			fmt.Fprintf(os.Stderr, "Dial failed - %s\n", dialError.Error())
+			os.Exit(1)
+		}
+
+		clients[i] = &benchClient{conn: conn, random: rand.New(rand.NewSource(int64(i)))}
+		wg.Add(1)
+		go func(c *benchClient) {
+			defer wg.Done()
+			c.run(window)
+		}(clients[i])
+	}
+	if result.Local {
+		for proxy.Server().GetStatus().CRess < *optClients {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Measure in the window after warmup
+	start := time.Now().Add(BenchWarmup)
+	atomic.StoreInt64(&window.end, start.Add(*optDuration).UnixNano())
+	atomic.StoreInt64(&window.start, start.UnixNano())
+
+	// Sample the peak heap of the local sbps and clients
+	memQuit := make(chan struct{})
+	memDone := make(chan struct{})
+	go func() {
+		defer close(memDone)
+		if !result.Local {
+			return
+		}
+
+		ticker := time.NewTicker(BenchMemTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-memQuit:
+				return
+			case <-ticker.C:
+				mem := &runtime.MemStats{}
+				runtime.ReadMemStats(mem)
+				if mem.HeapAlloc > result.HeapPeak {
+					result.HeapPeak = mem.HeapAlloc
+				}
+			}
+		}
+	}()
+
+	// Wait the window and frames in flight
+	time.Sleep(time.Until(start.Add(*optDuration).Add(BenchGrace)))
+	close(memQuit)
+	<-memDone
+
+	mem := &runtime.MemStats{}
+	runtime.ReadMemStats(mem)
+	goroutines := runtime.NumGoroutine()
+
+	for _, c := range clients {
+		c.conn.Close()
+	}
+	wg.Wait()
+
+	// Report
+	var samples []time.Duration
+	for _, c := range clients {
+		result.Frames += c.frames
+		result.ByteRate += float64(c.bytes)
+		samples = append(samples, c.samples...)
+	}
+	result.FrameRate = float64(result.Frames) / optDuration.Seconds()
+	result.ByteRate /= optDuration.Seconds()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	result.LatencyP50 = getPercentile(samples, 0.5)
+	result.LatencyP90 = getPercentile(samples, 0.9)
+	result.LatencyP99 = getPercentile(samples, 0.99)
+	result.LatencyMax = getPercentile(samples, 1)
+
+	if result.Local {
+		result.Generated = atomic.LoadInt64(&generated)
+		expected := result.Generated * int64(result.Clients)
+		if expected > result.Frames {
+			result.Drops = expected - result.Frames
+			result.DropRatio = float64(result.Drops) / float64(expected)
+		}
+
+		result.HeapAlloc = mem.HeapAlloc
+		result.Sys = mem.Sys
+		result.Goroutines = goroutines
+		if result.HeapAlloc > result.HeapPeak {
+			result.HeapPeak = result.HeapAlloc
+		}
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), BenchGrace)
+		proxy.Shutdown(shutdownCtx)
+		shutdownCancel()
+	}
+
+	printBench(result, *optFormat)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestGetPercentile checks percentiles of sorted latencies.
+func TestGetPercentile(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		samples []time.Duration
+		p       float64
+		want    float64
+	}{
+		{samples: nil, p: 0.5, want: 0},
+		{samples: samples[:1], p: 0.99, want: 1},
+		{samples: samples, p: 0, want: 1},
+		{samples: samples, p: 0.5, want: 50},
+		{samples: samples, p: 0.9, want: 90},
+		{samples: samples, p: 0.99, want: 99},
+		{samples: samples, p: 1, want: 100},
+		{samples: []time.Duration{500 * time.Microsecond}, p: 1, want: 0.5},
+	}
+
+	for _, test := range tests {
+		if got := getPercentile(test.samples, test.p); got != test.want {
+			t.Errorf("getPercentile() of %d samples at %v is %v, want %v",
+				len(test.samples), test.p, got, test.want)
+		}
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/ssup2/sbps/pkg/log"
 	"github.com/ssup2/sbps/pkg/res"
+	"github.com/ssup2/sbps/pkg/sbps"
 	"github.com/ssup2/sbps/pkg/server"
 )
 
@@ -19,47 +24,317 @@ var (
 	Build   string
 )
 
+// mLog is the logger with the main component field.
+var mLog = log.With(log.Fields{Component: log.CompMain})
+
+// Server resource options
+const (
+	SResOptGroup       = "group"
+	SResOptCorr        = "corr"
+	SResOptCorrField   = "corrfield"
+	SResOptCorrTimeout = "corrtimeout"
+	SResOptLock        = "lock"
+	SResOptLockPolicy  = "lockpolicy"
+	SResOptLockIdle    = "lockidle"
+	SResOptEcho        = "echo"
+	SResOptEchoWindow  = "echowindow"
+	SResOptFilter      = "filter"
+	SResOptRTransform  = "rtransform"
+	SResOptWTransform  = "wtransform"
+	SResOptRate        = "rate"
+	SResOptFrameRate   = "frate"
+	SResOptRateMode    = "ratemode"
+	SResOptBufSize     = "bufsize"
+	SResOptRecord      = "record"
+	SResOptSpeed       = "speed"
+	SResOptLoop        = "loop"
+	SResOptReplayRes   = "replayres"
+)
+
 // SResOpt represents a pair of server resource option
 type SResOpt struct {
 	sResType string
 	sResInfo []string
+	sResOpts url.Values
+}
+
+// HookOpts represents hook options which could be set several times
+type HookOpts []string
+
+// String returns hook options as a string
+func (o *HookOpts) String() string {
+	return strings.Join(*o, " ")
+}
+
+// Set appends a hook option
+func (o *HookOpts) Set(opt string) error {
+	*o = append(*o, opt)
+	return nil
 }
 
 // SplitSRes splits server resource option
 func SplitSRes(optSResLoc *string) *[]*SResOpt {
 	var sRess []*SResOpt
 
+	if strings.Compare(*optSResLoc, "") == 0 {
+		return &sRess
+	}
+
 	for _, sRes := range strings.Split(*optSResLoc, ",") {
-		rSplit := strings.Split(sRes, ":")
-		length := len(rSplit)
+		// Split options
+		query := ""
+		if i := strings.Index(sRes, "?"); i >= 0 {
+			query = sRes[i+1:]
+			sRes = sRes[:i]
+		}
+
+		opts, err := url.ParseQuery(query)
+		if err != nil {
+			mLog.Critf("Wrong server resource option - %s", query)
+			os.Exit(1)
+		}
+		for key := range opts {
+			switch key {
+			case SResOptGroup, SResOptCorr, SResOptCorrField, SResOptCorrTimeout,
+				SResOptLock, SResOptLockPolicy, SResOptLockIdle,
+				SResOptEcho, SResOptEchoWindow, SResOptFilter,
+				SResOptRTransform, SResOptWTransform,
+				SResOptRate, SResOptFrameRate, SResOptRateMode, SResOptBufSize,
+				SResOptRecord, SResOptSpeed, SResOptLoop, SResOptReplayRes:
+			default:
+				mLog.Critf("Wrong server resource option - %s", key)
+				os.Exit(1)
+			}
+		}
 
-		if length < 2 || length > 4 {
-			log.Critf("Wrong server resource option - %s", sRes)
+		// Resource info is checked by the factory of the resource type
+		rSplit := strings.Split(sRes, ":")
+		if len(rSplit) < 2 {
+			mLog.Critf("Wrong server resource option - %s", sRes)
 			os.Exit(1)
 		}
 
 		rType := rSplit[0]
 		rInfo := append(rSplit[:0], rSplit[1:]...)
-		sRess = append(sRess, &SResOpt{sResType: rType, sResInfo: rInfo})
+		sRess = append(sRess, &SResOpt{sResType: rType, sResInfo: rInfo, sResOpts: opts})
 	}
 
 	return &sRess
 }
 
+// SResOptions converts server resource options to library resource options
+func SResOptions(opts url.Values) []sbps.ResourceOption {
+	var options []sbps.ResourceOption
+
+	// Group
+	if group := opts.Get(SResOptGroup); group != "" {
+		options = append(options, sbps.ResGroup(group))
+	}
+
+	// Correlation
+	if corr := opts.Get(SResOptCorr); corr != "" {
+		timeout := 5 * time.Second
+		if opt := opts.Get(SResOptCorrTimeout); opt != "" {
+			tmp, err := time.ParseDuration(opt)
+			if err != nil {
+				mLog.Critf("Wrong correlation timeout - %s", opt)
+				os.Exit(1)
+			}
+			timeout = tmp
+		}
+		options = append(options, sbps.ResCorrelator(corr, opts.Get(SResOptCorrField), timeout))
+	}
+
+	// Writer lock
+	if lock := opts.Get(SResOptLock); lock != "" {
+		idle := 30 * time.Second
+		if opt := opts.Get(SResOptLockIdle); opt != "" {
+			tmp, err := time.ParseDuration(opt)
+			if err != nil {
+				mLog.Critf("Wrong lock idle timeout - %s", opt)
+				os.Exit(1)
+			}
+			idle = tmp
+		}
+
+		policy := res.LockReject
+		if opt := opts.Get(SResOptLockPolicy); opt != "" {
+			policy = opt
+		}
+		options = append(options, sbps.ResLock(lock, policy, idle))
+	}
+
+	// Echo suppression
+	if echo := opts.Get(SResOptEcho); echo != "" {
+		window := 100 * time.Millisecond
+		if opt := opts.Get(SResOptEchoWindow); opt != "" {
+			tmp, err := time.ParseDuration(opt)
+			if err != nil {
+				mLog.Critf("Wrong echo suppression window - %s", opt)
+				os.Exit(1)
+			}
+			window = tmp
+		}
+		options = append(options, sbps.ResEcho(echo, window))
+	}
+
+	// Filter
+	if filters, exist := opts[SResOptFilter]; exist {
+		options = append(options, sbps.ResFilter(filters...))
+	}
+
+	// Transform
+	if names, exist := opts[SResOptRTransform]; exist {
+		options = append(options, sbps.ResRTransform(names...))
+	}
+	if names, exist := opts[SResOptWTransform]; exist {
+		options = append(options, sbps.ResWTransform(names...))
+	}
+
+	// Read buffer size
+	if opt := opts.Get(SResOptBufSize); opt != "" {
+		size, err := strconv.Atoi(opt)
+		if err != nil {
+			mLog.Critf("Wrong read buffer size - %s", opt)
+			os.Exit(1)
+		}
+		options = append(options, sbps.ResBufSize(size))
+	}
+
+	// Rate limit
+	if opts.Get(SResOptRate) != "" || opts.Get(SResOptFrameRate) != "" {
+		var rates [2]float64
+		for i, key := range []string{SResOptRate, SResOptFrameRate} {
+			if opt := opts.Get(key); opt != "" {
+				tmp, err := strconv.ParseFloat(opt, 64)
+				if err != nil {
+					mLog.Critf("Wrong rate limit - %s", opt)
+					os.Exit(1)
+				}
+				rates[i] = tmp
+			}
+		}
+
+		mode := res.LimitDelay
+		if opt := opts.Get(SResOptRateMode); opt != "" {
+			mode = opt
+		}
+		options = append(options, sbps.ResRateLimit(mode, rates[0], rates[1]))
+	}
+
+	// Record
+	if path := opts.Get(SResOptRecord); path != "" {
+		options = append(options, sbps.ResRecord(path))
+	}
+	return options
+}
+
+// SetReplayOpts sets replay options to a replay resource
+func SetReplayOpts(r *res.Replay, speed string, loop string, replayRes string) {
+	if speed != "" {
+		tmp, err := strconv.ParseFloat(speed, 64)
+		if err == nil {
+			err = r.SetSpeed(tmp)
+		}
+		if err != nil {
+			mLog.Critf("Wrong replay speed - %s", speed)
+			os.Exit(1)
+		}
+	}
+	if loop != "" {
+		tmp, err := strconv.ParseBool(loop)
+		if err != nil {
+			mLog.Critf("Wrong replay loop - %s", loop)
+			os.Exit(1)
+		}
+		r.SetLoop(tmp)
+	}
+	if replayRes != "" {
+		r.SetRes(&replayRes)
+	}
+}
+
+// SplitGroups splits group option and allocates groups
+func SplitGroups(optGroup *string) []*res.Group {
+	var groups []*res.Group
+
+	if strings.Compare(*optGroup, "") == 0 {
+		return groups
+	}
+
+	for _, group := range strings.Split(*optGroup, ",") {
+		gSplit := strings.Split(group, ":")
+		if len(gSplit) < 2 {
+			mLog.Critf("Wrong group option - %s", group)
+			os.Exit(1)
+		}
+
+		g, err := res.NewGroup(&gSplit[0], &gSplit[1], gSplit[2:])
+		if err != nil {
+			mLog.Critf("Wrong group option - %s", group)
+			os.Exit(1)
+		}
+		groups = append(groups, g)
+	}
+
+	return groups
+}
+
 func main() {
+	// Commands
+	if len(os.Args) > 1 && strings.Compare(os.Args[1], CmdReplay) == 0 {
+		MainReplay(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && strings.Compare(os.Args[1], CmdBench) == 0 {
+		MainBench(os.Args[2:])
+		return
+	}
+
 	// Options
 	optVersion := flag.Bool("v", false,
 		"Print version")
 	optMode := flag.String("mode", server.TypeTCP+":6060",
-		"sbps proxy server mode (option TCP:port, UNIX:path)")
+		"sbps proxy server mode (option TCP:port, UNIX:path, suffix ?rtransform=name&wtransform=name&rate=bytes&frate=frames&ratemode=DELAY|DROP&wtimeout=500ms&record=path)")
 	optSResLoc := flag.String("resource", "",
-		"Server resources (option TCP:ip:port[:RW], UDP:ip:port[:RW], UNIX:path[:RW], FIFO:path[:RW])")
+		"Server resources (option TCP:ip:port[:RW], UDP:ip:port[:RW], UNIX:path[:RW], FIFO:path[:RW], REPLAY:path, MEM:name[:RW], GEN:COUNTER|RANDOM[/size]|FIXED/payload|TIME[/size]:rate[:count], suffix ?group=name&corr=SERIAL|JSON&corrfield=field&corrtimeout=5s&lock=EXPLICIT|IMPLICIT&lockpolicy=REJECT|QUEUE&lockidle=30s&echo=WINDOW|FRAME&echowindow=100ms&filter=include|exclude:regex|prefix|json:expr&rtransform=name&wtransform=name&rate=bytes&frate=frames&ratemode=DELAY|DROP&bufsize=4096&record=path&speed=1&loop=true&replayres=info)")
+	optGroup := flag.String("group", "",
+		"Server resource groups (option name:FAILOVER[:FAILBACK], name:BROADCAST, name:ROUNDROBIN, name:RANDOM, name:LEASTPENDING, name:HASH)")
+	optHTTP := flag.String("http", "",
+		"HTTP listener for stream and write endpoints (option TCP:port, UNIX:path)")
+	optMonitor := flag.String("monitor", "",
+		"Monitor listener for clients which receive all traffic (option TCP:port, UNIX:path)")
+	optMonitorFormat := flag.String("monitorformat", server.MonitorText,
+		"Format of monitor clients (option TEXT, JSON)")
+	optHub := flag.String("hub", server.HubNone,
+		"Client hub mode (option NONE, ALL, OTHERS)")
+	optRetries := flag.Int("retries", 0,
+		"Maximum number of reopen retries for a closed server resource (0 means unlimited)")
+	var optHooks HookOpts
+	flag.Var(&optHooks, "hook",
+		"Event hook, could be set several times (option EVENT[|EVENT...]:EXEC:command, EVENT[|EVENT...]:WEBHOOK:url, EVENT RES_OPEN, RES_CLOSE, RES_RECONNECT, RES_RETRY_EXHAUSTED, CLIENT_CONNECT, CLIENT_DISCONNECT, ALL)")
+	optMinOpen := flag.Int("minopen", 1,
+		"Minimum number of open server resources for readiness (0 in hub mode if not set)")
 	optSResInter := flag.Int("interval", 2,
 		"Seconds of retry interval for closed server resources")
+	optShutdown := flag.Duration("shutdowntimeout", 5*time.Second,
+		"Timeout to drain pending writes and hooks on exit")
 	optLogPath := flag.String("logpath", "./sbps.log",
 		"Log path")
 	optLogLevel := flag.String("loglevel", "INFO",
 		"Log level (option DEBUG, INFO, WARN, ERROR, CRIT)")
+	optLogFormat := flag.String("logformat", log.OptText,
+		"Log format (option TEXT, JSON)")
+	optLogSink := flag.String("logsink", log.SinkFile,
+		"Log sinks (option FILE, STDOUT, STDERR, SYSLOG[:path])")
+	optLogMaxSize := flag.Int("logmaxsize", 0,
+		"Megabytes of a log file to rotate (0 means no size limit)")
+	optLogMaxAge := flag.Duration("logmaxage", 0,
+		"Age of a log file to rotate (0 means no age limit)")
+	optLogBackups := flag.Int("logbackups", 0,
+		"Number of rotated log files to retain (0 means retain all)")
+	optLogGzip := flag.Bool("loggzip", false,
+		"Compress rotated log files with gzip")
 	flag.Parse()
 
 	if *optVersion {
@@ -67,26 +342,78 @@ func main() {
 		return
 	}
 
-	if (len(os.Args) < 2) || strings.Compare(*optSResLoc, "") == 0 {
+	if (len(os.Args) < 2) || (strings.Compare(*optSResLoc, "") == 0 &&
+		strings.Compare(*optHub, server.HubNone) == 0) {
 		flag.PrintDefaults()
 		return
 	}
 
 	// Logger
-	logError := log.Init(optLogPath, optLogLevel)
+	logRotate := &log.Rotate{
+		MaxSize:  int64(*optLogMaxSize) * 1024 * 1024,
+		MaxAge:   *optLogMaxAge,
+		Backups:  *optLogBackups,
+		Compress: *optLogGzip,
+	}
+	logError := log.Init(optLogPath, optLogLevel, optLogFormat,
+		strings.Split(*optLogSink, ","), logRotate)
 	if logError != nil {
-		log.Critf("Init file logger failed - %s", logError.Error())
+		fmt.Fprintf(os.Stderr, "Init file logger failed - %s\n", logError.Error())
 		os.Exit(1)
 	}
 	defer log.Clean()
 
-	// Server
-	server, serverError := server.New(optMode, *optSResInter)
-	if serverError != nil {
-		log.Critf("Allocation of a server failed - %s", serverError.Error())
+	// Proxy options
+	ln, lnError := sbps.ParseListener(*optMode)
+	if lnError != nil {
+		mLog.WithErr(lnError).Critf("Wrong mode option - %s", lnError.Error())
 		os.Exit(1)
 	}
-	defer server.Close()
+
+	options := []sbps.Option{
+		sbps.WithListener(ln),
+		sbps.WithRetryInterval(time.Duration(*optSResInter) * time.Second),
+		sbps.WithMaxRetry(*optRetries),
+		sbps.WithHub(*optHub),
+	}
+
+	// The minimum depends on the hub mode if it is not set
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "minopen" {
+			options = append(options, sbps.WithMinOpen(*optMinOpen))
+		}
+	})
+
+	for _, opt := range optHooks {
+		hook, hookError := server.NewHook(&opt)
+		if hookError != nil {
+			mLog.WithErr(hookError).Critf("Wrong hook option (%s) - %s", opt, hookError.Error())
+			os.Exit(1)
+		}
+		options = append(options, sbps.WithHook(hook))
+	}
+
+	if strings.Compare(*optMonitor, "") != 0 {
+		monitorLn, monitorError := sbps.ParseListener(*optMonitor)
+		if monitorError != nil {
+			mLog.WithErr(monitorError).Critf("Wrong monitor option - %s", monitorError.Error())
+			os.Exit(1)
+		}
+		options = append(options, sbps.WithMonitor(monitorLn, *optMonitorFormat))
+	}
+
+	if strings.Compare(*optHTTP, "") != 0 {
+		httpLn, httpError := sbps.ParseListener(*optHTTP)
+		if httpError != nil {
+			mLog.WithErr(httpError).Critf("Wrong HTTP option - %s", httpError.Error())
+			os.Exit(1)
+		}
+		options = append(options, sbps.WithHTTP(httpLn))
+	}
+
+	for _, g := range SplitGroups(optGroup) {
+		options = append(options, sbps.WithGroup(g))
+	}
 
 	sRess := SplitSRes(optSResLoc)
 	for _, sRes := range *sRess {
@@ -97,39 +424,95 @@ func main() {
 				resStr += (":" + info)
 			}
 
-			log.Critf("Allocation a server resource (%s) error - %s",
+			mLog.WithRes(resStr).WithErr(resError).Critf("Allocation a server resource (%s) error - %s",
 				resStr, resError.Error())
 			os.Exit(1)
 		}
 
-		h := res.NewHandler(r, server.GetSResHNoti())
-		openError := r.Open()
-		if openError != nil {
-			log.Warnf("Open of a server resource error - %s", openError.Error())
-
-			if *optSResInter > 0 {
-				server.AddSResHandler(h)
-				server.AddSResClosedHandler(h)
+		// Replay
+		opts := sRes.sResOpts
+		if opts.Get(SResOptSpeed) != "" || opts.Get(SResOptLoop) != "" ||
+			opts.Get(SResOptReplayRes) != "" {
+			replay, ok := r.(*res.Replay)
+			if !ok {
+				mLog.Critf("Wrong replay option - %s", *r.GetInfo())
+				os.Exit(1)
 			}
-		} else {
-			server.AddSResHandler(h)
-			h.Run()
+			SetReplayOpts(replay, opts.Get(SResOptSpeed), opts.Get(SResOptLoop),
+				opts.Get(SResOptReplayRes))
 		}
+
+		options = append(options, sbps.WithResource(sbps.Raw{Res: r}, SResOptions(opts)...))
 	}
-	server.Run()
 
-	// Set signal and block main goroutine
-	sigs := make(chan os.Signal)
-	block := make(chan struct{})
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGSTOP)
+	// Proxy
+	proxy, proxyError := sbps.New(options...)
+	if proxyError != nil {
+		mLog.WithErr(proxyError).Critf("Allocation of a proxy failed - %s",
+			proxyError.Error())
+		os.Exit(1)
+	}
+
+	// Block main goroutine until a signal to exit or all server resources
+	// are closed
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		sig := <-sigs
-		log.Infof("Get signal - %s", sig)
-		block <- struct{}{}
+		WaitSignals(ctx.Done())
+		cancel()
 	}()
 
-	log.Infof("Block main goroutine")
-	<-block
-	log.Infof("Unblock main goroutine and exit main")
+	runError := proxy.Run(ctx)
+	cancel()
+	if runError != nil && runError != context.Canceled {
+		mLog.WithErr(runError).Critf("Run of a proxy failed - %s", runError.Error())
+		proxy.Shutdown(context.Background())
+		os.Exit(1)
+	}
+	mLog.Infof("Unblock main goroutine and exit main")
+
+	// Drain pending writes and hooks
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), *optShutdown)
+	defer shutdownCancel()
+	shutdownError := proxy.Shutdown(shutdownCtx)
+	if shutdownError != nil {
+		mLog.WithErr(shutdownError).Warnf("Shutdown of a proxy failed - %s", shutdownError.Error())
+	}
 	return
 }
+
+// WaitSignals handles signals and blocks until a signal to exit or done
+// is closed.
+func WaitSignals(done <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	block := make(chan struct{}, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGSTOP,
+		syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigs {
+			mLog.Infof("Get signal - %s", sig)
+
+			// Reopen log files for external log rotation
+			if sig == syscall.SIGUSR1 {
+				if err := log.Reopen(); err != nil {
+					mLog.WithErr(err).Errorf("Reopen log files failed - %s", err.Error())
+				}
+				continue
+			}
+
+			// Toggle debug log level
+			if sig == syscall.SIGUSR2 {
+				mLog.Infof("Toggle log level - %s", log.ToggleDebug())
+				continue
+			}
+
+			block <- struct{}{}
+			return
+		}
+	}()
+
+	mLog.Infof("Block main goroutine")
+	select {
+	case <-block:
+	case <-done:
+	}
+}
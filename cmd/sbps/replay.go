@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/log"
+	"github.com/ssup2/sbps/pkg/res"
+	"github.com/ssup2/sbps/pkg/server"
+)
+
+// Commands
+const (
+	CmdReplay = "replay"
+	CmdBench  = "bench"
+)
+
+// MainReplay plays a recording back as a server resource. Replay starts
+// when the number of clients is connected, and sbps exits at the end of
+// the recording.
+func MainReplay(args []string) {
+	// Options
+	flags := flag.NewFlagSet(CmdReplay, flag.ExitOnError)
+	optMode := flags.String("mode", server.TypeTCP+":6060",
+		"sbps proxy server mode (option TCP:port, UNIX:path)")
+	optFile := flags.String("file", "",
+		"Recording file")
+	optSpeed := flags.String("speed", "1",
+		"Speed scale of replay (2 plays twice as fast)")
+	optLoop := flags.Bool("loop", false,
+		"Play the recording repeatedly")
+	optRes := flags.String("res", "",
+		"Resource info of records to play (empty means all server resources)")
+	optClients := flags.Int("clients", 1,
+		"Number of clients to wait before replay")
+	optLogPath := flags.String("logpath", "./sbps.log",
+		"Log path")
+	optLogLevel := flags.String("loglevel", "INFO",
+		"Log level (option DEBUG, INFO, WARN, ERROR, CRIT)")
+	flags.Parse(args)
+
+	if strings.Compare(*optFile, "") == 0 {
+		flags.PrintDefaults()
+		return
+	}
+
+	// Logger
+	logFormat := log.OptText
+	logError := log.Init(optLogPath, optLogLevel, &logFormat, nil, nil)
+	if logError != nil {
+		fmt.Fprintf(os.Stderr, "Init file logger failed - %s\n", logError.Error())
+		os.Exit(1)
+	}
+	defer log.Clean()
+
+	// Server
+	server, serverError := server.New(optMode, 0)
+	if serverError != nil {
+		mLog.WithErr(serverError).Critf("Allocation of a server failed - %s",
+			serverError.Error())
+		os.Exit(1)
+	}
+	defer server.Close()
+
+	// Replay resource
+	r := res.NewReplay(optFile)
+	SetReplayOpts(r, *optSpeed, strconv.FormatBool(*optLoop), *optRes)
+	openError := r.Open()
+	if openError != nil {
+		mLog.WithRes(*r.GetInfo()).WithErr(openError).Critf(
+			"Open of a server resource error - %s", openError.Error())
+		os.Exit(1)
+	}
+
+	h := res.NewHandler(r, server.GetSResHNoti())
+	server.AddSResHandler(h)
+	runError := server.Run()
+	if runError != nil {
+		mLog.WithErr(runError).Critf("Run of a server failed - %s", runError.Error())
+		os.Exit(1)
+	}
+
+	// Start replay after clients are connected
+	go func() {
+		for server.GetStatus().CRess < *optClients {
+			time.Sleep(100 * time.Millisecond)
+		}
+		mLog.WithRes(*r.GetInfo()).Infof("Start replay - %s", *r.GetInfo())
+		h.Run()
+	}()
+
+	// Block main goroutine until the end of the recording
+	WaitSignals(server.Done())
+	mLog.Infof("Unblock main goroutine and exit main")
+}
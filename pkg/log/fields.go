@@ -0,0 +1,160 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Fields contains structured fields of a log event. Empty fields are
+// omitted in JSON format, and fields are not printed in text format
+// because messages already contain them.
+type Fields struct {
+	Component string
+	Res       string
+	Client    string
+	Err       error
+}
+
+// event is a log event in JSON format.
+type event struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+	Res       string `json:"resource,omitempty"`
+	Client    string `json:"client,omitempty"`
+	Err       string `json:"error,omitempty"`
+	Caller    string `json:"caller"`
+	Msg       string `json:"msg"`
+}
+
+// levelNames maps log level to level name in JSON format.
+var levelNames = map[int]string{
+	LevelDebug: OptDebug,
+	LevelInfo:  OptInfo,
+	LevelWarn:  OptWarn,
+	LevelError: OptError,
+	LevelCrit:  OptCrit,
+}
+
+// output writes a log event. It must be called by a logging function
+// which is called by the caller to be logged.
+func output(level int, fields *Fields, msg string) {
+	l := getLogger()
+	if l.format == FormatText {
+		switch level {
+		case LevelDebug:
+			l.logDebug.Output(3, msg)
+		case LevelInfo:
+			l.logInfo.Output(3, msg)
+		case LevelWarn:
+			l.logWarn.Output(3, msg)
+		case LevelError:
+			l.logError.Output(3, msg)
+		case LevelCrit:
+			l.logCrit.Output(3, msg)
+		}
+		return
+	}
+
+	e := event{
+		Time:  time.Now().Format(time.RFC3339Nano),
+		Level: levelNames[level],
+		Msg:   msg,
+	}
+	if _, file, line, ok := runtime.Caller(2); ok {
+		e.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	if fields != nil {
+		e.Component = fields.Component
+		e.Res = fields.Res
+		e.Client = fields.Client
+		if fields.Err != nil {
+			e.Err = fields.Err.Error()
+		}
+	}
+
+	b, err := json.Marshal(&e)
+	if err != nil {
+		return
+	}
+	l.writeSinks(level, append(b, '\n'))
+}
+
+// Entry is a logger with structured fields.
+type Entry struct {
+	fields Fields
+}
+
+// With returns a logger with the fields.
+func With(fields Fields) *Entry {
+	return &Entry{fields: fields}
+}
+
+// WithErr returns a copy of the logger with the error field.
+func (e *Entry) WithErr(err error) *Entry {
+	fields := e.fields
+	fields.Err = err
+	return &Entry{fields: fields}
+}
+
+// WithRes returns a copy of the logger with the resource field.
+func (e *Entry) WithRes(res string) *Entry {
+	fields := e.fields
+	fields.Res = res
+	return &Entry{fields: fields}
+}
+
+// WithClient returns a copy of the logger with the client field.
+func (e *Entry) WithClient(client string) *Entry {
+	fields := e.fields
+	fields.Client = client
+	return &Entry{fields: fields}
+}
+
+// Debugf works the same as printf with debug prefix and fields
+func (e *Entry) Debugf(format string, v ...interface{}) {
+	if getFieldsLevel(&e.fields) > LevelDebug {
+		return
+	}
+
+	output(LevelDebug, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Infof works the same as printf with information prefix and fields
+func (e *Entry) Infof(format string, v ...interface{}) {
+	if getFieldsLevel(&e.fields) > LevelInfo {
+		return
+	}
+
+	output(LevelInfo, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Warnf works the same as printf with warning prefix and fields
+func (e *Entry) Warnf(format string, v ...interface{}) {
+	if getFieldsLevel(&e.fields) > LevelWarn {
+		return
+	}
+
+	output(LevelWarn, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Errorf works the same as printf with error prefix and fields
+func (e *Entry) Errorf(format string, v ...interface{}) {
+	if getFieldsLevel(&e.fields) > LevelError {
+		return
+	}
+
+	output(LevelError, &e.fields, fmt.Sprintf(format, v...))
+}
+
+// Critf works the same as printf with critical prefix and fields
+func (e *Entry) Critf(format string, v ...interface{}) {
+	if getFieldsLevel(&e.fields) > LevelCrit {
+		return
+	}
+
+	output(LevelCrit, &e.fields, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,119 @@
+package log
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrLevel is error instance for wrong log level.
+var ErrLevel = errors.New("Wrong log level")
+
+// levels contains log levels which could be changed at runtime.
+// Overrides are keyed by a component or info of a resource or a client.
+var levels = struct {
+	level     int32
+	initLevel int32
+
+	overridesLock *sync.RWMutex
+	overrides     map[string]int
+	overrideCnt   int32
+}{
+	level:         LevelInfo,
+	initLevel:     LevelInfo,
+	overridesLock: &sync.RWMutex{},
+	overrides:     make(map[string]int),
+}
+
+// LevelStatus represents log levels of the logger.
+type LevelStatus struct {
+	Level     string            `json:"level"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+// getLevel returns the global log level.
+func getLevel() int {
+	return int(atomic.LoadInt32(&levels.level))
+}
+
+// getFieldsLevel returns the log level of the fields. Overrides of the
+// resource and the client have priority over overrides of the component.
+func getFieldsLevel(fields *Fields) int {
+	if atomic.LoadInt32(&levels.overrideCnt) == 0 {
+		return getLevel()
+	}
+
+	levels.overridesLock.RLock()
+	defer levels.overridesLock.RUnlock()
+
+	for _, key := range []string{fields.Res, fields.Client, fields.Component} {
+		if key == "" {
+			continue
+		}
+		if level, exist := levels.overrides[key]; exist {
+			return level
+		}
+	}
+	return getLevel()
+}
+
+// SetLevel sets the global log level.
+func SetLevel(level *string) error {
+	logLevel := MapLevel(level)
+	if logLevel == LevelWrong {
+		return ErrLevel
+	}
+
+	atomic.StoreInt32(&levels.level, int32(logLevel))
+	return nil
+}
+
+// ToggleDebug toggles the global log level between debug and the level
+// set at Init, and returns the new level.
+func ToggleDebug() string {
+	if getLevel() == LevelDebug {
+		atomic.StoreInt32(&levels.level, atomic.LoadInt32(&levels.initLevel))
+	} else {
+		atomic.StoreInt32(&levels.level, LevelDebug)
+	}
+	return levelNames[getLevel()]
+}
+
+// SetOverride sets the log level of a component, a resource or a client.
+func SetOverride(key *string, level *string) error {
+	logLevel := MapLevel(level)
+	if logLevel == LevelWrong {
+		return ErrLevel
+	}
+
+	levels.overridesLock.Lock()
+	defer levels.overridesLock.Unlock()
+
+	levels.overrides[*key] = logLevel
+	atomic.StoreInt32(&levels.overrideCnt, int32(len(levels.overrides)))
+	return nil
+}
+
+// DeleteOverride deletes the log level override of the key.
+func DeleteOverride(key *string) {
+	levels.overridesLock.Lock()
+	defer levels.overridesLock.Unlock()
+
+	delete(levels.overrides, *key)
+	atomic.StoreInt32(&levels.overrideCnt, int32(len(levels.overrides)))
+}
+
+// GetLevelStatus returns the global log level and overrides.
+func GetLevelStatus() *LevelStatus {
+	levels.overridesLock.RLock()
+	defer levels.overridesLock.RUnlock()
+
+	status := &LevelStatus{
+		Level:     levelNames[getLevel()],
+		Overrides: make(map[string]string),
+	}
+	for key, level := range levels.overrides {
+		status.Overrides[key] = levelNames[level]
+	}
+	return status
+}
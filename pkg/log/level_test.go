@@ -0,0 +1,132 @@
+package log
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initTest initializes the logger to write to a file of the test, and
+// returns a function which reads logs of the file.
+func initTest(t *testing.T, level string, format string) func() string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sbps.log")
+	if err := Init(&path, &level, &format, nil, nil); err != nil {
+		t.Fatalf("Init() error - %v", err)
+	}
+	t.Cleanup(Clean)
+
+	return func() string {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile() error - %v", err)
+		}
+		return string(b)
+	}
+}
+
+// TestLevelOverride checks the global log level and overrides are applied
+// to package-level logging functions and entries.
+func TestLevelOverride(t *testing.T) {
+	res := With(Fields{Component: CompHandler, Res: "TCP:127.0.0.1:5000"})
+	client := With(Fields{Component: CompHandler, Client: "CONN:TCP:127.0.0.1:40000"})
+
+	tests := []struct {
+		name      string
+		level     string
+		overrides map[string]string
+		log       func()
+		want      bool
+	}{
+		{name: "global debug", level: OptInfo, log: func() { Debugf("msg") }},
+		{name: "global info", level: OptInfo, log: func() { Infof("msg") }, want: true},
+		{
+			name:      "main override debug",
+			level:     OptInfo,
+			overrides: map[string]string{CompMain: OptDebug},
+			log:       func() { Debugf("msg") },
+			want:      true,
+		},
+		{
+			name:      "main override error",
+			level:     OptInfo,
+			overrides: map[string]string{CompMain: OptError},
+			log:       func() { Warn("msg") },
+		},
+		{
+			name:      "main override crit",
+			level:     OptDebug,
+			overrides: map[string]string{CompMain: OptCrit},
+			log:       func() { Errorln("msg") },
+		},
+		{
+			name:      "other override",
+			level:     OptInfo,
+			overrides: map[string]string{CompServer: OptDebug},
+			log:       func() { Debugf("msg") },
+		},
+		{
+			name:      "resource over component",
+			level:     OptInfo,
+			overrides: map[string]string{CompHandler: OptError, "TCP:127.0.0.1:5000": OptDebug},
+			log:       func() { res.Debugf("msg") },
+			want:      true,
+		},
+		{
+			name:      "component of client",
+			level:     OptInfo,
+			overrides: map[string]string{CompHandler: OptError, "TCP:127.0.0.1:5000": OptDebug},
+			log:       func() { client.Warnf("msg") },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			read := initTest(t, test.level, OptText)
+			for key, level := range test.overrides {
+				key, level := key, level
+				if err := SetOverride(&key, &level); err != nil {
+					t.Fatalf("SetOverride() error - %v", err)
+				}
+				t.Cleanup(func() { DeleteOverride(&key) })
+			}
+
+			test.log()
+			if got := read() != ""; got != test.want {
+				t.Errorf("Logged %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestOutput checks callers and fields of package-level logging functions
+// in text and JSON formats.
+func TestOutput(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		read := initTest(t, OptInfo, OptText)
+		Infof("text %d", 1)
+
+		got := read()
+		if !strings.HasPrefix(got, PrefixInfo) || !strings.Contains(got, "level_test.go") ||
+			!strings.HasSuffix(got, "text 1\n") {
+			t.Errorf("Log is %q", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		read := initTest(t, OptInfo, OptJSON)
+		Warnf("json %d", 2)
+
+		var e event
+		if err := json.Unmarshal([]byte(read()), &e); err != nil {
+			t.Fatalf("Unmarshal() error - %v", err)
+		}
+		if e.Level != OptWarn || e.Component != CompMain || e.Msg != "json 2" ||
+			!strings.HasPrefix(e.Caller, "level_test.go:") {
+			t.Errorf("Log is %+v", e)
+		}
+	})
+}
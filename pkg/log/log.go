@@ -5,6 +5,8 @@ import (
 	"fmt"
 	_log "log"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
 // Constants for logger.
@@ -27,17 +29,47 @@ const (
 	PrefixWarn  = "[Warn] : "
 	PrefixError = "[Erro] : "
 	PrefixCrit  = "[Crit] : "
+
+	FormatWrong = 0
+	FormatText  = 1
+	FormatJSON  = 2
+
+	OptText = "TEXT"
+	OptJSON = "JSON"
+)
+
+// Log components.
+const (
+	CompMain     = "main"
+	CompServer   = "server"
+	CompListener = "listener"
+	CompHandler  = "handler"
 )
 
-// log is grobal Logger instance
-var log *Logger
+// log is grobal Logger instance, which is replaced by Init while other
+// goroutines log. Logs are written to stderr until Init is called, so
+// packages could log without Init when they are embedded.
+var log atomic.Value
+
+func init() {
+	log.Store(newLogger(FormatText, []sink{&streamSink{fp: os.Stderr}}))
+}
+
+// getLogger returns the grobal Logger instance.
+func getLogger() *Logger {
+	return log.Load().(*Logger)
+}
+
+// mainFields is fields of logs by package-level logging functions, so
+// level overrides of the main component are applied to them.
+var mainFields = Fields{Component: CompMain}
 
 // Logger contains logger's info and basic logger instances.
 type Logger struct {
-	path *string
-	fp   *os.File
+	format int
 
-	level int
+	lock  *sync.Mutex
+	sinks []sink
 
 	logDebug *_log.Logger
 	logInfo  *_log.Logger
@@ -46,46 +78,84 @@ type Logger struct {
 	logCrit  *_log.Logger
 }
 
-// Init sets log path and logger's level.
-func Init(path *string, level *string) error {
+// Init sets log path, logger's level, logger's format and log sinks.
+// The path is used by the file sink. If no sink is set, logs are written
+// to the file of the path, or stdout if the path is nil.
+func Init(path *string, level *string, format *string, sinkOpts []string,
+	rotate *Rotate) error {
 	logLevel := MapLevel(level)
 	if logLevel == LevelWrong {
-		return errors.New("Wrong log level")
+		return ErrLevel
+	}
+	logFormat := MapFormat(format)
+	if logFormat == FormatWrong {
+		return errors.New("Wrong log format")
 	}
 
-	if path != nil {
-		logFp, err := os.OpenFile(*path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if len(sinkOpts) == 0 {
+		if path != nil {
+			sinkOpts = []string{SinkFile}
+		} else {
+			sinkOpts = []string{SinkStdout}
+		}
+	}
+
+	var sinks []sink
+	for _, opt := range sinkOpts {
+		s, err := newSink(opt, path, rotate)
 		if err != nil {
+			for _, s := range sinks {
+				s.close()
+			}
 			return err
 		}
-
-		logDebug := _log.New(logFp, PrefixDebug, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logInfo := _log.New(logFp, PrefixInfo, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logWarn := _log.New(logFp, PrefixWarn, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logError := _log.New(logFp, PrefixError, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logCrit := _log.New(logFp, PrefixCrit, _log.Ldate|_log.Ltime|_log.Lshortfile)
-
-		log = &Logger{path: path, fp: logFp, level: logLevel, logDebug: logDebug,
-			logInfo: logInfo, logWarn: logWarn, logError: logError, logCrit: logCrit}
-	} else {
-		logDebug := _log.New(os.Stdout, PrefixDebug, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logInfo := _log.New(os.Stdout, PrefixInfo, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logWarn := _log.New(os.Stdout, PrefixWarn, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logError := _log.New(os.Stdout, PrefixError, _log.Ldate|_log.Ltime|_log.Lshortfile)
-		logCrit := _log.New(os.Stdout, PrefixCrit, _log.Ldate|_log.Ltime|_log.Lshortfile)
-
-		log = &Logger{path: nil, fp: nil, level: logLevel, logDebug: logDebug,
-			logInfo: logInfo, logWarn: logWarn, logError: logError, logCrit: logCrit}
+		sinks = append(sinks, s)
 	}
 
+	atomic.StoreInt32(&levels.level, int32(logLevel))
+	atomic.StoreInt32(&levels.initLevel, int32(logLevel))
+	log.Store(newLogger(logFormat, sinks))
 	return nil
 }
 
+// newLogger allocates a logger which writes to the sinks.
+func newLogger(format int, sinks []sink) *Logger {
+	l := &Logger{format: format, lock: &sync.Mutex{}, sinks: sinks}
+
+	flags := _log.Ldate | _log.Ltime | _log.Lshortfile
+	l.logDebug = _log.New(&levelWriter{l: l, level: LevelDebug}, PrefixDebug, flags)
+	l.logInfo = _log.New(&levelWriter{l: l, level: LevelInfo}, PrefixInfo, flags)
+	l.logWarn = _log.New(&levelWriter{l: l, level: LevelWarn}, PrefixWarn, flags)
+	l.logError = _log.New(&levelWriter{l: l, level: LevelError}, PrefixError, flags)
+	l.logCrit = _log.New(&levelWriter{l: l, level: LevelCrit}, PrefixCrit, flags)
+	return l
+}
+
 // Clean clears the logger
 func Clean() {
-	if log.fp != nil {
-		log.fp.Close()
+	l := getLogger()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, s := range l.sinks {
+		s.close()
+	}
+}
+
+// Reopen reopens log files. It is used to reopen log files moved by
+// external log rotation.
+func Reopen() error {
+	l := getLogger()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var err error
+	for _, s := range l.sinks {
+		if reopenErr := s.reopen(); reopenErr != nil && err == nil {
+			err = reopenErr
+		}
 	}
+	return err
 }
 
 // MapLevel maps option to log level.
@@ -106,137 +176,149 @@ func MapLevel(opt *string) int {
 	}
 }
 
+// MapFormat maps option to log format.
+func MapFormat(opt *string) int {
+	switch *opt {
+	case OptText:
+		return FormatText
+	case OptJSON:
+		return FormatJSON
+	default:
+		return FormatWrong
+	}
+}
+
 // Debugf works the same as printf with debug prefix
 func Debugf(format string, v ...interface{}) {
-	if log.level > LevelDebug {
+	if getFieldsLevel(&mainFields) > LevelDebug {
 		return
 	}
 
-	log.logDebug.Output(2, fmt.Sprintf(format, v...))
+	output(LevelDebug, &mainFields, fmt.Sprintf(format, v...))
 }
 
 // Debug works the same as print with debug prefix
 func Debug(v ...interface{}) {
-	if log.level > LevelDebug {
+	if getFieldsLevel(&mainFields) > LevelDebug {
 		return
 	}
 
-	log.logDebug.Output(2, fmt.Sprint(v...))
+	output(LevelDebug, &mainFields, fmt.Sprint(v...))
 }
 
 // Debugln works the same as println with debug prefix
 func Debugln(v ...interface{}) {
-	if log.level > LevelDebug {
+	if getFieldsLevel(&mainFields) > LevelDebug {
 		return
 	}
 
-	log.logDebug.Output(2, fmt.Sprint(v...))
+	output(LevelDebug, &mainFields, fmt.Sprint(v...))
 }
 
 // Infof works the same as printf with information prefix
 func Infof(format string, v ...interface{}) {
-	if log.level > LevelInfo {
+	if getFieldsLevel(&mainFields) > LevelInfo {
 		return
 	}
 
-	log.logInfo.Output(2, fmt.Sprintf(format, v...))
+	output(LevelInfo, &mainFields, fmt.Sprintf(format, v...))
 }
 
 // Info works the same as print with information prefix
 func Info(v ...interface{}) {
-	if log.level > LevelInfo {
+	if getFieldsLevel(&mainFields) > LevelInfo {
 		return
 	}
 
-	log.logInfo.Output(2, fmt.Sprint(v...))
+	output(LevelInfo, &mainFields, fmt.Sprint(v...))
 }
 
 // Infoln works the same as println with information prefix
 func Infoln(v ...interface{}) {
-	if log.level > LevelInfo {
+	if getFieldsLevel(&mainFields) > LevelInfo {
 		return
 	}
 
-	log.logInfo.Output(2, fmt.Sprint(v...))
+	output(LevelInfo, &mainFields, fmt.Sprint(v...))
 }
 
 // Warnf works the same as printf with warning prefix
 func Warnf(format string, v ...interface{}) {
-	if log.level > LevelWarn {
+	if getFieldsLevel(&mainFields) > LevelWarn {
 		return
 	}
 
-	log.logWarn.Output(2, fmt.Sprintf(format, v...))
+	output(LevelWarn, &mainFields, fmt.Sprintf(format, v...))
 }
 
 // Warn works the same as print with warning prefix
 func Warn(v ...interface{}) {
-	if log.level > LevelWarn {
+	if getFieldsLevel(&mainFields) > LevelWarn {
 		return
 	}
 
-	log.logWarn.Output(2, fmt.Sprint(v...))
+	output(LevelWarn, &mainFields, fmt.Sprint(v...))
 }
 
 // Warnln works the same as println with warning prefix
 func Warnln(v ...interface{}) {
-	if log.level > LevelWarn {
+	if getFieldsLevel(&mainFields) > LevelWarn {
 		return
 	}
 
-	log.logWarn.Output(2, fmt.Sprint(v...))
+	output(LevelWarn, &mainFields, fmt.Sprint(v...))
 }
 
 // Errorf works the same as printf with error prefix
 func Errorf(format string, v ...interface{}) {
-	if log.level > LevelError {
+	if getFieldsLevel(&mainFields) > LevelError {
 		return
 	}
 
-	log.logError.Output(2, fmt.Sprintf(format, v...))
+	output(LevelError, &mainFields, fmt.Sprintf(format, v...))
 }
 
 // Error works the same as print with error prefix
 func Error(v ...interface{}) {
-	if log.level > LevelError {
+	if getFieldsLevel(&mainFields) > LevelError {
 		return
 	}
 
-	log.logError.Output(2, fmt.Sprint(v...))
+	output(LevelError, &mainFields, fmt.Sprint(v...))
 }
 
 // Errorln works the same as println with error prefix
 func Errorln(v ...interface{}) {
-	if log.level > LevelError {
+	if getFieldsLevel(&mainFields) > LevelError {
 		return
 	}
 
-	log.logError.Output(2, fmt.Sprint(v...))
+	output(LevelError, &mainFields, fmt.Sprint(v...))
 }
 
 // Critf works the same as printf with critical prefix
 func Critf(format string, v ...interface{}) {
-	if log.level > LevelCrit {
+	if getFieldsLevel(&mainFields) > LevelCrit {
 		return
 	}
 
-	log.logCrit.Output(2, fmt.Sprintf(format, v...))
+	output(LevelCrit, &mainFields, fmt.Sprintf(format, v...))
 }
 
 // Crit works the same as print with critical prefix
 func Crit(v ...interface{}) {
-	if log.level > LevelCrit {
+	if getFieldsLevel(&mainFields) > LevelCrit {
 		return
 	}
 
-	log.logCrit.Output(2, fmt.Sprint(v...))
+	output(LevelCrit, &mainFields, fmt.Sprint(v...))
 }
 
 // Critln works the same as println with critical prefix
 func Critln(v ...interface{}) {
-	if log.level > LevelCrit {
+	if getFieldsLevel(&mainFields) > LevelCrit {
 		return
 	}
 
-	log.logCrit.Output(2, fmt.Sprint(v...))
+	output(LevelCrit, &mainFields, fmt.Sprint(v...))
 }
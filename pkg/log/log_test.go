@@ -0,0 +1,46 @@
+package log
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestInitConcurrent checks Init replaces the logger while other
+// goroutines log, and logs after Init are written by the new logger.
+func TestInitConcurrent(t *testing.T) {
+	initTest(t, OptInfo, OptText)
+
+	quit := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-quit:
+					return
+				default:
+					Infof("msg")
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 8; i++ {
+		format := OptText
+		if i%2 == 1 {
+			format = OptJSON
+		}
+		initTest(t, OptInfo, format)
+	}
+	close(quit)
+	wg.Wait()
+
+	read := initTest(t, OptInfo, OptJSON)
+	Infof("last")
+	if logs := read(); !strings.Contains(logs, `"msg":"last"`) {
+		t.Errorf("Logs after Init() are %q, want the last log", logs)
+	}
+}
@@ -0,0 +1,389 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for log sinks.
+const (
+	SinkFile   = "FILE"
+	SinkStdout = "STDOUT"
+	SinkStderr = "STDERR"
+	SinkSyslog = "SYSLOG"
+
+	SyslogPath = "/dev/log"
+	SyslogTag  = "sbps"
+
+	BackupTimeFormat = "20060102-150405.000000"
+	BackupGzipSuffix = ".gz"
+
+	RotateRetryInterval = time.Minute
+)
+
+// ErrSink is error instance for wrong log sink option.
+var ErrSink = errors.New("Wrong log sink")
+
+// Rotate contains options of log file rotation. Zero values mean no limit.
+// Backups is the number of rotated files to retain.
+type Rotate struct {
+	MaxSize  int64
+	MaxAge   time.Duration
+	Backups  int
+	Compress bool
+}
+
+// sink is a destination of log events.
+type sink interface {
+	write(level int, b []byte) error
+	reopen() error
+	close() error
+}
+
+// newSink allocates a sink from the option.
+func newSink(opt string, path *string, rotate *Rotate) (sink, error) {
+	opts := strings.SplitN(opt, ":", 2)
+	switch opts[0] {
+	case SinkFile:
+		if path == nil || len(opts) != 1 {
+			return nil, ErrSink
+		}
+		return newFileSink(*path, rotate)
+	case SinkStdout:
+		if len(opts) != 1 {
+			return nil, ErrSink
+		}
+		return &streamSink{fp: os.Stdout}, nil
+	case SinkStderr:
+		if len(opts) != 1 {
+			return nil, ErrSink
+		}
+		return &streamSink{fp: os.Stderr}, nil
+	case SinkSyslog:
+		if len(opts) == 1 {
+			return newSyslogSink(SyslogPath)
+		}
+		return newSyslogSink(opts[1])
+	default:
+		return nil, ErrSink
+	}
+}
+
+// levelWriter writes log events of a level to all sinks of the logger.
+type levelWriter struct {
+	l     *Logger
+	level int
+}
+
+// Write writes a log event to all sinks.
+func (w *levelWriter) Write(b []byte) (int, error) {
+	w.l.writeSinks(w.level, b)
+	return len(b), nil
+}
+
+// writeSinks writes a log event to all sinks. Errors of sinks are
+// ignored because there is no place to report them.
+func (l *Logger) writeSinks(level int, b []byte) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, s := range l.sinks {
+		s.write(level, b)
+	}
+}
+
+// streamSink writes log events to a standard stream.
+type streamSink struct {
+	fp *os.File
+}
+
+func (s *streamSink) write(level int, b []byte) error {
+	_, err := s.fp.Write(b)
+	return err
+}
+
+func (s *streamSink) reopen() error {
+	return nil
+}
+
+func (s *streamSink) close() error {
+	return nil
+}
+
+// syslogSink sends log events to syslog over a local UNIX socket.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// newSyslogSink connects to the syslog socket of the path.
+func newSyslogSink(path string) (*syslogSink, error) {
+	var err error
+	for _, network := range []string{"unixgram", "unix"} {
+		var w *syslog.Writer
+		w, err = syslog.Dial(network, path, syslog.LOG_DAEMON|syslog.LOG_INFO, SyslogTag)
+		if err == nil {
+			return &syslogSink{w: w}, nil
+		}
+	}
+	return nil, err
+}
+
+func (s *syslogSink) write(level int, b []byte) error {
+	msg := strings.TrimSuffix(string(b), "\n")
+	switch level {
+	case LevelDebug:
+		return s.w.Debug(msg)
+	case LevelInfo:
+		return s.w.Info(msg)
+	case LevelWarn:
+		return s.w.Warning(msg)
+	case LevelError:
+		return s.w.Err(msg)
+	default:
+		return s.w.Crit(msg)
+	}
+}
+
+func (s *syslogSink) reopen() error {
+	return nil
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
+
+// fileSink writes log events to a file. The file is rotated by size and
+// age, and rotated files are compressed and removed in background. The age
+// is counted from the first log event of the file, so it is kept across
+// restarts.
+type fileSink struct {
+	path   string
+	rotate Rotate
+
+	fp      *os.File
+	size    int64
+	started time.Time
+	retry   time.Time // Rotation is not tried until retry
+
+	cleanLock *sync.Mutex
+}
+
+// newFileSink opens the log file of the path.
+func newFileSink(path string, rotate *Rotate) (*fileSink, error) {
+	s := &fileSink{path: path, cleanLock: &sync.Mutex{}}
+	if rotate != nil {
+		s.rotate = *rotate
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the log file in append mode.
+func (s *fileSink) open() error {
+	fp, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+
+	s.fp = fp
+	s.size = info.Size()
+	s.started = getStartTime(s.path, info)
+	return nil
+}
+
+// getStartTime returns the time of the first log event of the log file.
+// The modification time is used if the time of the first log event could
+// not be parsed, and now is used for an empty file.
+func getStartTime(path string, info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return time.Now()
+	}
+
+	fp, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer fp.Close()
+
+	b := make([]byte, 256)
+	n, _ := io.ReadFull(fp, b)
+	line := b[:n]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	if t, ok := parseEventTime(line); ok {
+		return t
+	}
+	return info.ModTime()
+}
+
+// parseEventTime parses the time of a log event in text or JSON format.
+// The time is the first field of both formats.
+func parseEventTime(line []byte) (time.Time, bool) {
+	jsonPrefix := []byte(`{"time":"`)
+	if bytes.HasPrefix(line, jsonPrefix) {
+		line = line[len(jsonPrefix):]
+		i := bytes.IndexByte(line, '"')
+		if i < 0 {
+			return time.Time{}, false
+		}
+		t, err := time.Parse(time.RFC3339Nano, string(line[:i]))
+		return t, err == nil
+	}
+
+	textLayout := "2006/01/02 15:04:05"
+	if len(line) < len(PrefixInfo)+len(textLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(textLayout,
+		string(line[len(PrefixInfo):len(PrefixInfo)+len(textLayout)]), time.Local)
+	return t, err == nil
+}
+
+func (s *fileSink) write(level int, b []byte) error {
+	if ((s.rotate.MaxSize > 0 && s.size > 0 && s.size+int64(len(b)) > s.rotate.MaxSize) ||
+		(s.rotate.MaxAge > 0 && time.Since(s.started) > s.rotate.MaxAge)) &&
+		time.Now().After(s.retry) {
+		s.rotateFile()
+	}
+	if s.fp == nil {
+		// Retry to open if the last open is failed
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.fp.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) reopen() error {
+	if s.fp != nil {
+		s.fp.Close()
+		s.fp = nil
+	}
+	return s.open()
+}
+
+func (s *fileSink) close() error {
+	if s.fp == nil {
+		return nil
+	}
+	err := s.fp.Close()
+	s.fp = nil
+	return err
+}
+
+// rotateFile renames the log file to a backup file and opens a new log file.
+// If the log file could not be renamed, the log file is opened again and
+// rotation is retried after RotateRetryInterval.
+func (s *fileSink) rotateFile() error {
+	s.close()
+
+	backup := s.path + "." + time.Now().Format(BackupTimeFormat)
+	renameErr := os.Rename(s.path, backup)
+	if renameErr != nil {
+		s.retry = time.Now().Add(RotateRetryInterval)
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	go s.clean(backup)
+	return nil
+}
+
+// clean compresses the backup file and removes old backup files over
+// the retention count.
+func (s *fileSink) clean(backup string) {
+	s.cleanLock.Lock()
+	defer s.cleanLock.Unlock()
+
+	if s.rotate.Compress {
+		compress(backup)
+	}
+
+	if s.rotate.Backups <= 0 {
+		return
+	}
+
+	dir := filepath.Dir(s.path)
+	prefix := filepath.Base(s.path) + "."
+	fps, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	names, err := fps.Readdirnames(-1)
+	fps.Close()
+	if err != nil {
+		return
+	}
+
+	var backups []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), BackupGzipSuffix)
+		if _, err := time.Parse(BackupTimeFormat, stamp); err != nil {
+			continue
+		}
+		backups = append(backups, name)
+	}
+
+	// Names of backup files are ordered by rotated time
+	sort.Strings(backups)
+	for i := 0; i < len(backups)-s.rotate.Backups; i++ {
+		os.Remove(filepath.Join(dir, backups[i]))
+	}
+}
+
+// compress compresses the file with gzip and removes the original file.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+BackupGzipSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + BackupGzipSuffix)
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,170 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getBackups returns backup files of the log file.
+func getBackups(t *testing.T, path string) []string {
+	t.Helper()
+
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob() error - %v", err)
+	}
+	return backups
+}
+
+// TestFileSinkRotate checks log files are rotated by size and age, and
+// the age of an existing log file is counted from its first log event.
+func TestFileSinkRotate(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+
+	tests := []struct {
+		name    string
+		rotate  Rotate
+		content string
+		mtime   time.Time
+		writes  []string
+		want    int // number of backups
+	}{
+		{
+			name:   "no limit",
+			writes: []string{"a\n", "b\n"},
+		},
+		{
+			name:   "size",
+			rotate: Rotate{MaxSize: 4},
+			writes: []string{"a\n", "b\n", "c\n", "d\n", "e\n"},
+			want:   2,
+		},
+		{
+			name:   "age of a new file",
+			rotate: Rotate{MaxAge: time.Hour},
+			writes: []string{"a\n", "b\n"},
+		},
+		{
+			name:    "age of an old text file",
+			rotate:  Rotate{MaxAge: time.Hour},
+			content: PrefixInfo + old.Format("2006/01/02 15:04:05") + " main.go:1: old\n",
+			writes:  []string{"a\n", "b\n"},
+			want:    1,
+		},
+		{
+			name:    "age of an old JSON file",
+			rotate:  Rotate{MaxAge: time.Hour},
+			content: `{"time":"` + old.Format(time.RFC3339Nano) + `","level":"INFO"}` + "\n",
+			writes:  []string{"a\n", "b\n"},
+			want:    1,
+		},
+		{
+			name:    "age of a recent text file",
+			rotate:  Rotate{MaxAge: time.Hour},
+			content: PrefixInfo + time.Now().Format("2006/01/02 15:04:05") + " main.go:1: new\n",
+			writes:  []string{"a\n"},
+		},
+		{
+			name:    "age by modification time",
+			rotate:  Rotate{MaxAge: time.Hour},
+			content: "no time\n",
+			mtime:   old,
+			writes:  []string{"a\n", "b\n"},
+			want:    1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sbps.log")
+			if test.content != "" {
+				if err := os.WriteFile(path, []byte(test.content), 0666); err != nil {
+					t.Fatalf("WriteFile() error - %v", err)
+				}
+			}
+			if !test.mtime.IsZero() {
+				if err := os.Chtimes(path, test.mtime, test.mtime); err != nil {
+					t.Fatalf("Chtimes() error - %v", err)
+				}
+			}
+
+			s, err := newFileSink(path, &test.rotate)
+			if err != nil {
+				t.Fatalf("newFileSink() error - %v", err)
+			}
+			defer s.close()
+
+			for _, w := range test.writes {
+				if err := s.write(LevelInfo, []byte(w)); err != nil {
+					t.Fatalf("write() error - %v", err)
+				}
+			}
+
+			if backups := getBackups(t, path); len(backups) != test.want {
+				t.Errorf("Backups are %v, want %d backups", backups, test.want)
+			}
+		})
+	}
+}
+
+// TestFileSinkBackups checks old backups over the retention count are
+// removed and backups are compressed.
+func TestFileSinkBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sbps.log")
+	s, err := newFileSink(path, &Rotate{MaxSize: 2, Backups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("newFileSink() error - %v", err)
+	}
+	defer s.close()
+
+	for _, w := range []string{"a\n", "b\n", "c\n", "d\n", "e\n"} {
+		s.write(LevelInfo, []byte(w))
+		// Backup times are in microseconds
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var backups []string
+	for time.Now().Before(deadline) {
+		s.cleanLock.Lock()
+		backups = getBackups(t, path)
+		s.cleanLock.Unlock()
+		if len(backups) == 2 && strings.HasSuffix(backups[0], BackupGzipSuffix) &&
+			strings.HasSuffix(backups[1], BackupGzipSuffix) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Backups are %v, want 2 compressed backups", backups)
+}
+
+// TestFileSinkRotateRetry checks rotation is not retried for each log
+// event after the log file could not be renamed.
+func TestFileSinkRotateRetry(t *testing.T) {
+	// The name of backup files is too long to be renamed
+	path := filepath.Join(t.TempDir(), strings.Repeat("a", 250))
+	s, err := newFileSink(path, &Rotate{MaxSize: 2})
+	if err != nil {
+		t.Fatalf("newFileSink() error - %v", err)
+	}
+	defer s.close()
+
+	for _, w := range []string{"a\n", "b\n", "c\n"} {
+		if err := s.write(LevelInfo, []byte(w)); err != nil {
+			t.Fatalf("write() error - %v", err)
+		}
+	}
+
+	if s.retry.Before(time.Now().Add(RotateRetryInterval / 2)) {
+		t.Errorf("Retry of rotation is %v, want after %v", s.retry, RotateRetryInterval)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "a\nb\nc\n" {
+		t.Errorf("Log file is %q, want %q", b, "a\nb\nc\n")
+	}
+	if backups := getBackups(t, path); len(backups) != 0 {
+		t.Errorf("Backups are %v, want no backups", backups)
+	}
+}
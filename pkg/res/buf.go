@@ -0,0 +1,83 @@
+package res
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// bufPools is global buffer pools by buffer size.
+var bufPools = struct {
+	lock  *sync.Mutex
+	pools map[int]*BufPool
+}{
+	lock:  &sync.Mutex{},
+	pools: make(map[int]*BufPool),
+}
+
+// BufPool represents a pool of same size buffers.
+type BufPool struct {
+	size int
+	pool *sync.Pool
+}
+
+// GetBufPool returns the buffer pool of the size. Handlers with the same
+// read buffer size share a buffer pool.
+func GetBufPool(size int) *BufPool {
+	bufPools.lock.Lock()
+	defer bufPools.lock.Unlock()
+
+	p, exist := bufPools.pools[size]
+	if exist {
+		return p
+	}
+
+	p = &BufPool{size: size}
+	p.pool = &sync.Pool{
+		New: func() interface{} {
+			return &Buf{b: make([]byte, size), ref: 0, pool: p}
+		},
+	}
+	bufPools.pools[size] = p
+	return p
+}
+
+// Get gets a buffer which has a reference from the pool.
+func (p *BufPool) Get() *Buf {
+	buf := p.pool.Get().(*Buf)
+	buf.ref = 1
+	return buf
+}
+
+// GetSize returns size of buffers in the pool.
+func (p *BufPool) GetSize() int {
+	return p.size
+}
+
+// Buf represents a reference counted buffer. The buffer returns to the pool
+// when the last reference is released, so the buffer must not be used
+// after Release.
+type Buf struct {
+	b    []byte
+	ref  int32
+	pool *BufPool
+}
+
+// Bytes returns the whole buffer.
+func (buf *Buf) Bytes() []byte {
+	return buf.b
+}
+
+// Ref adds a reference of the buffer.
+func (buf *Buf) Ref() {
+	atomic.AddInt32(&buf.ref, 1)
+}
+
+// Release releases a reference of the buffer.
+func (buf *Buf) Release() {
+	ref := atomic.AddInt32(&buf.ref, -1)
+	if ref == 0 {
+		buf.pool.pool.Put(buf)
+	} else if ref < 0 {
+		panic("Release of a released buffer")
+	}
+}
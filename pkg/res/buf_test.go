@@ -0,0 +1,166 @@
+package res
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/log"
+)
+
+func init() {
+	level := log.OptCrit
+	format := log.OptText
+	log.Init(nil, &level, &format, nil, nil)
+}
+
+// benchRes is a resource which reads queued messages and discards writes.
+type benchRes struct {
+	info    string
+	msgs    chan []byte
+	written *sync.WaitGroup
+	rable   bool
+}
+
+func (res *benchRes) GetInfo() *string { return &res.info }
+func (res *benchRes) Open() error      { return nil }
+func (res *benchRes) Close() error     { return nil }
+func (res *benchRes) IsOpen() bool     { return true }
+func (res *benchRes) IsRable() bool    { return res.rable }
+func (res *benchRes) IsWable() bool    { return !res.rable }
+
+func (res *benchRes) Read(b []byte) (n int, err error) {
+	msg, ok := <-res.msgs
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(b, msg), nil
+}
+
+func (res *benchRes) Write(b []byte) (n int, err error) {
+	res.written.Done()
+	return len(b), nil
+}
+
+// benchSink keeps buffers escaping to the heap like buffers passed to Read.
+var benchSink []byte
+
+// BenchmarkReadBufMake measures allocating a read buffer per read.
+func BenchmarkReadBufMake(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := make([]byte, ReadBufSize)
+		buf[0] = byte(i)
+		benchSink = buf
+	}
+}
+
+// BenchmarkReadBufPool measures getting a read buffer from the pool.
+func BenchmarkReadBufPool(b *testing.B) {
+	b.ReportAllocs()
+	p := GetBufPool(ReadBufSize)
+	for i := 0; i < b.N; i++ {
+		buf := p.Get()
+		buf.Bytes()[0] = byte(i)
+		benchSink = buf.Bytes()
+		buf.Release()
+	}
+}
+
+// BenchmarkHandlerFanOut measures broadcast of messages from a server
+// resource handler to client handlers.
+func BenchmarkHandlerFanOut(b *testing.B) {
+	msg := make([]byte, 256)
+
+	for _, clients := range []int{1, 10, 100} {
+		for _, size := range []int{ReadBufSize, 64 * 1024} {
+			b.Run(fmt.Sprintf("clients=%d/bufsize=%d", clients, size), func(b *testing.B) {
+				written := &sync.WaitGroup{}
+				src := &benchRes{info: "BENCH:SRC", msgs: make(chan []byte), rable: true}
+				sResH := NewHandler(src, nil)
+				sResH.SetReadBufSize(size)
+
+				var cResHs []*Handler
+				for i := 0; i < clients; i++ {
+					dst := &benchRes{info: fmt.Sprintf("BENCH:DST:%d", i), written: written}
+					cResH := NewHandler(dst, nil)
+					cResH.Run()
+					sResH.AddWriteTarget(cResH)
+					cResHs = append(cResHs, cResH)
+				}
+				sResH.Run()
+				b.Cleanup(func() {
+					close(src.msgs)
+					sResH.Close()
+					for _, cResH := range cResHs {
+						cResH.Close()
+					}
+				})
+
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				written.Add(b.N * clients)
+				for i := 0; i < b.N; i++ {
+					src.msgs <- msg
+				}
+				written.Wait()
+
+				b.StopTimer()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.NumGC-before.NumGC), "gcs")
+			})
+		}
+	}
+}
+
+// TestBufRefQueue checks the write queue holds a reference of the read
+// buffer until data is written, and data without a buffer is copied.
+func TestBufRefQueue(t *testing.T) {
+	blocked := newBlockRes("block")
+	h := NewHandler(blocked, nil)
+	policy := WriteDrop
+	if err := h.SetWriteQueue(4, &policy); err != nil {
+		t.Fatalf("SetWriteQueue() error - %v", err)
+	}
+	h.Run()
+	t.Cleanup(func() {
+		h.Close()
+		blocked.Close()
+	})
+
+	buf := GetBufPool(ReadBufSize).Get()
+	n := copy(buf.Bytes(), "buf\n")
+	if _, err := h.writeFrom(nil, buf, buf.Bytes()[:n]); err != nil {
+		t.Fatalf("writeFrom() error - %v", err)
+	}
+	buf.Release()
+	if ref := atomic.LoadInt32(&buf.ref); ref != 1 {
+		t.Fatalf("Reference of the queued buffer is %d, want 1", ref)
+	}
+
+	data := []byte("copy\n")
+	if _, err := h.Write(data); err != nil {
+		t.Fatalf("Write() error - %v", err)
+	}
+	copy(data, "xxxx\n")
+
+	close(blocked.unblock)
+	deadline := time.Now().Add(testTimeout)
+	for h.GetPending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ref := atomic.LoadInt32(&buf.ref); ref != 0 {
+		t.Errorf("Reference of the written buffer is %d, want 0", ref)
+	}
+	if got := blocked.getWritten(); got != "buf\ncopy\n" {
+		t.Errorf("Written %q, want %q", got, "buf\ncopy\n")
+	}
+}
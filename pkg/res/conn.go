@@ -6,6 +6,8 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 // Conn represents a connection from a client.
@@ -62,6 +64,17 @@ func (res *Conn) GetInfo() *string {
 	return &tmp
 }
 
+// GetHost get the IP of a TCP client or the address of a UNIX client,
+// without the port which changes for each connection.
+func (res *Conn) GetHost() string {
+	switch addr := res.conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	default:
+		return addr.String()
+	}
+}
+
 func (res *Conn) Read(b []byte) (n int, err error) {
 	return res.conn.Read(b)
 }
@@ -70,6 +83,20 @@ func (res *Conn) Write(b []byte) (n int, err error) {
 	return res.conn.Write(b)
 }
 
+// SetWriteDeadline sets the deadline of writes to the connection.
+func (res *Conn) SetWriteDeadline(t time.Time) error {
+	return res.conn.SetWriteDeadline(t)
+}
+
+// SyscallConn returns the raw connection of the client socket.
+func (res *Conn) SyscallConn() (syscall.RawConn, error) {
+	c, ok := res.conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("Do not support SyscallConn()")
+	}
+	return c.SyscallConn()
+}
+
 // IsOpen checks open of the resource.
 func (res *Conn) IsOpen() bool {
 	res.isOpenLock.Lock()
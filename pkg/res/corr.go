@@ -0,0 +1,238 @@
+package res
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Correlation modes.
+const (
+	CorrSerial = "SERIAL"
+	CorrJSON   = "JSON"
+)
+
+// CorrMaxFrame is the max size of a JSON frame. A partial frame longer
+// than it is handled as a frame.
+const CorrMaxFrame = 64 * 1024
+
+// ErrCorr is error instance for wrong correlation option.
+var ErrCorr = errors.New("Wrong correlation option")
+
+// corrReq represents an outstanding request of a client.
+type corrReq struct {
+	src  *Handler
+	time time.Time
+}
+
+// CorrFrame represents a response frame of a server resource and the
+// client which sent the request of the frame.
+type CorrFrame struct {
+	src  *Handler
+	data []byte
+}
+
+// Correlator routes response frames of a server resource to the client
+// which sent the request. In serial mode, requests are serialized and
+// data following a request is the response until a newline, so
+// a response could be read in several chunks. In JSON mode, requests and
+// responses are newline-delimited JSON frames matched by a JSON field.
+type Correlator struct {
+	mode    string
+	field   []string
+	timeout time.Duration
+
+	lock     *sync.Mutex
+	pending  *corrReq
+	released chan struct{}
+	reqs     map[string]*corrReq
+	rRest    []byte
+	wRests   map[*Handler][]byte
+}
+
+// NewCorrelator allocates and initializes a correlator instance.
+// field is a dotted JSON field path used in JSON mode.
+func NewCorrelator(mode *string, field *string, timeout time.Duration) (*Correlator, error) {
+	c := &Correlator{
+		mode:    *mode,
+		field:   nil,
+		timeout: timeout,
+
+		lock:     &sync.Mutex{},
+		pending:  nil,
+		released: nil,
+		reqs:     make(map[string]*corrReq),
+		rRest:    nil,
+		wRests:   make(map[*Handler][]byte),
+	}
+
+	switch *mode {
+	case CorrSerial:
+	case CorrJSON:
+		if field == nil || *field == "" {
+			return nil, ErrCorr
+		}
+		c.field = strings.Split(*field, ".")
+	default:
+		return nil, ErrCorr
+	}
+
+	if timeout <= 0 {
+		return nil, ErrCorr
+	}
+
+	return c, nil
+}
+
+// getJSONField gets the value of a dotted JSON field path in a JSON frame.
+func getJSONField(b []byte, path []string) (string, bool) {
+	var v interface{}
+	if json.Unmarshal(b, &v) != nil {
+		return "", false
+	}
+
+	for _, key := range path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		v, ok = obj[key]
+		if !ok {
+			return "", false
+		}
+	}
+
+	return fmt.Sprint(v), true
+}
+
+// Request registers a request of a client. In serial mode, it blocks
+// until the outstanding request is answered or timed out.
+func (c *Correlator) Request(src *Handler, b []byte) {
+	switch c.mode {
+	case CorrSerial:
+		for {
+			c.lock.Lock()
+			if c.pending == nil || time.Since(c.pending.time) >= c.timeout {
+				if c.pending != nil {
+					c.pending.src.logger().Warnf("Correlator - request timeout - %s", *c.pending.src.GetRes().GetInfo())
+				}
+				c.pending = &corrReq{src: src, time: time.Now()}
+				c.released = make(chan struct{})
+				c.lock.Unlock()
+				return
+			}
+
+			released := c.released
+			remain := c.timeout - time.Since(c.pending.time)
+			c.lock.Unlock()
+
+			select {
+			case <-released:
+			case <-time.After(remain):
+			}
+		}
+
+	case CorrJSON:
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		// Partial frames are kept for each client, because data of
+		// clients are interleaved
+		rest := c.wRests[src]
+		frames := splitLines(&rest, b, CorrMaxFrame)
+		if len(rest) > 0 {
+			c.wRests[src] = rest
+		} else {
+			delete(c.wRests, src)
+		}
+
+		c.purge()
+		for _, frame := range frames {
+			if value, ok := getJSONField(frame, c.field); ok {
+				c.reqs[value] = &corrReq{src: src, time: time.Now()}
+			}
+		}
+	}
+}
+
+// purge clears timed out requests in JSON mode. It must be called with
+// the lock.
+func (c *Correlator) purge() {
+	for key, req := range c.reqs {
+		if time.Since(req.time) >= c.timeout {
+			req.src.logger().Warnf("Correlator - request timeout - %s - %s",
+				*req.src.GetRes().GetInfo(), key)
+			delete(c.reqs, key)
+		}
+	}
+}
+
+// Cancel cancels the outstanding request of a client in serial mode, and
+// drops the partial request frame of the client in JSON mode.
+func (c *Correlator) Cancel(src *Handler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.wRests, src)
+
+	if c.pending != nil && c.pending.src == src {
+		c.pending = nil
+		close(c.released)
+	}
+}
+
+// Response splits data of a server resource into response frames, and
+// returns the frames with clients which sent the requests of them. nil
+// client means the frame is unsolicited. In serial mode, data is a frame,
+// and the request is answered when the frame has a newline. The timeout
+// of the request is reset by each frame of the response. In JSON mode,
+// the trailing partial frame is kept until the rest of the frame is read.
+func (c *Correlator) Response(b []byte) []*CorrFrame {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch c.mode {
+	case CorrSerial:
+		if c.pending == nil {
+			return []*CorrFrame{{src: nil, data: b}}
+		}
+
+		src := c.pending.src
+		if time.Since(c.pending.time) >= c.timeout {
+			src.logger().Warnf("Correlator - request timeout - %s", *src.GetRes().GetInfo())
+			c.pending = nil
+			close(c.released)
+			return []*CorrFrame{{src: nil, data: b}}
+		}
+
+		if bytes.IndexByte(b, '\n') >= 0 {
+			c.pending = nil
+			close(c.released)
+		} else {
+			c.pending.time = time.Now()
+		}
+		return []*CorrFrame{{src: src, data: b}}
+
+	case CorrJSON:
+		c.purge()
+
+		var frames []*CorrFrame
+		for _, data := range splitLines(&c.rRest, b, CorrMaxFrame) {
+			frame := &CorrFrame{src: nil, data: data}
+			if value, ok := getJSONField(data, c.field); ok {
+				if req, exist := c.reqs[value]; exist {
+					delete(c.reqs, value)
+					frame.src = req.src
+				}
+			}
+			frames = append(frames, frame)
+		}
+		return frames
+	}
+
+	return nil
+}
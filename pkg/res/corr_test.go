@@ -0,0 +1,179 @@
+package res
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCorrelatorResponse checks response frames are routed to the client
+// which sent the request.
+func TestCorrelatorResponse(t *testing.T) {
+	type step struct {
+		req   int // client of a request, -1 means a response
+		data  string
+		sleep time.Duration
+		want  []int // clients of response frames, -1 means unsolicited
+	}
+
+	tests := []struct {
+		name  string
+		mode  string
+		field string
+		steps []step
+	}{
+		{
+			name: "serial",
+			mode: CorrSerial,
+			steps: []step{
+				{req: 0, data: "get\n"},
+				{req: -1, data: "value\n", want: []int{0}},
+				{req: -1, data: "event\n", want: []int{-1}},
+			},
+		},
+		{
+			name: "serial split response",
+			mode: CorrSerial,
+			steps: []step{
+				{req: 1, data: "get\n"},
+				{req: -1, data: "val", want: []int{1}},
+				{req: -1, data: "ue\nne", want: []int{1}},
+				{req: -1, data: "xt\n", want: []int{-1}},
+			},
+		},
+		{
+			name: "serial timeout",
+			mode: CorrSerial,
+			steps: []step{
+				{req: 0, data: "get\n"},
+				{req: -1, data: "val", sleep: 60 * time.Millisecond, want: []int{-1}},
+				{req: -1, data: "ue\n", want: []int{-1}},
+			},
+		},
+		{
+			name:  "json",
+			mode:  CorrJSON,
+			field: "header.id",
+			steps: []step{
+				{req: 0, data: "{\"header\":{\"id\":1}}\n"},
+				{req: 1, data: "{\"header\":{\"id\":2}}\n"},
+				{req: -1, data: "{\"header\":{\"id\":2},\"v\":\"b\"}\n", want: []int{1}},
+				{req: -1, data: "{\"header\":{\"id\":1},\"v\":\"a\"}\n", want: []int{0}},
+				{req: -1, data: "{\"header\":{\"id\":1},\"v\":\"a\"}\n", want: []int{-1}},
+				{req: -1, data: "not json\n", want: []int{-1}},
+			},
+		},
+		{
+			name:  "json frames",
+			mode:  CorrJSON,
+			field: "id",
+			steps: []step{
+				{req: 0, data: "{\"id\":1}\n{\"id\""},
+				{req: 1, data: "{\"id\":2}\n"},
+				{req: 0, data: ":3}\n"},
+				{req: -1, data: "{\"id\":3}\n{\"id\":2}\n{\"id\"", want: []int{0, 1}},
+				{req: -1, data: ":1}\n", want: []int{0}},
+			},
+		},
+		{
+			name:  "json timeout",
+			mode:  CorrJSON,
+			field: "id",
+			steps: []step{
+				{req: 0, data: "{\"id\":\"x\"}\n"},
+				{req: -1, data: "{\"id\":\"x\"}\n", sleep: 60 * time.Millisecond, want: []int{-1}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := NewCorrelator(&test.mode, &test.field, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("NewCorrelator() error - %v", err)
+			}
+
+			var clients []*Handler
+			for _, m := range []string{"a", "b"} {
+				name := testName(t, m)
+				clients = append(clients, NewHandler(NewMem(&name, (1<<ModeR)|(1<<ModeW)), nil))
+			}
+
+			for i, s := range test.steps {
+				time.Sleep(s.sleep)
+				if s.req >= 0 {
+					c.Request(clients[s.req], []byte(s.data))
+					continue
+				}
+
+				frames := c.Response([]byte(s.data))
+				if len(frames) != len(s.want) {
+					t.Fatalf("Step %d - Response(%q) has %d frames, want %d", i, s.data,
+						len(frames), len(s.want))
+				}
+				for j, frame := range frames {
+					var want *Handler
+					if s.want[j] >= 0 {
+						want = clients[s.want[j]]
+					}
+					if frame.src != want {
+						t.Errorf("Step %d - client of frame %q is %v, want %v", i, frame.data,
+							frame.src, want)
+					}
+				}
+			}
+
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			if c.pending != nil || len(c.reqs) != 0 || len(c.rRest) != 0 ||
+				len(c.wRests) != 0 {
+				t.Errorf("Requests are left - %v %v %q %v", c.pending, c.reqs, c.rRest,
+					c.wRests)
+			}
+		})
+	}
+}
+
+// TestCorrelatorSerial checks a request waits until the response of the
+// outstanding request ends.
+func TestCorrelatorSerial(t *testing.T) {
+	mode := CorrSerial
+	c, err := NewCorrelator(&mode, nil, testTimeout)
+	if err != nil {
+		t.Fatalf("NewCorrelator() error - %v", err)
+	}
+
+	var clients []*Handler
+	for _, m := range []string{"a", "b"} {
+		name := testName(t, m)
+		clients = append(clients, NewHandler(NewMem(&name, (1<<ModeR)|(1<<ModeW)), nil))
+	}
+
+	c.Request(clients[0], []byte("get a\n"))
+	done := make(chan struct{})
+	go func() {
+		c.Request(clients[1], []byte("get b\n"))
+		close(done)
+	}()
+
+	if got := c.Response([]byte("val")); got[0].src != clients[0] {
+		t.Fatalf("Response() is %v, want the first client", got[0].src)
+	}
+	select {
+	case <-done:
+		t.Fatalf("Request() is not blocked before the response ends")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if got := c.Response([]byte("ue a\n")); got[0].src != clients[0] {
+		t.Fatalf("Response() is %v, want the first client", got[0].src)
+	}
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatalf("Request() is blocked after the response ends")
+	}
+
+	if got := c.Response([]byte("value b\n")); got[0].src != clients[1] {
+		t.Errorf("Response() is %v, want the second client", got[0].src)
+	}
+}
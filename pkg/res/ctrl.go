@@ -0,0 +1,93 @@
+package res
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Control commands from clients. A control command is a line which
+// starts with CtrlPrefix, and it is not written to server resources.
+const (
+	CtrlPrefix = "#!sbps "
+
+	CtrlLock   = "lock"
+	CtrlUnlock = "unlock"
+	CtrlFilter = "filter"
+
+	CtrlMaxLine = 4 * 1024
+)
+
+// ctrlMsg formats a control message to clients.
+func ctrlMsg(format string, v ...interface{}) []byte {
+	return []byte(CtrlPrefix + fmt.Sprintf(format, v...) + "\n")
+}
+
+// isCtrl checks the line is a control command.
+func isCtrl(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(CtrlPrefix))
+}
+
+// mayCtrl checks the partial line could be a control command. A partial
+// line longer than CtrlMaxLine is not a control command.
+func mayCtrl(b []byte) bool {
+	return len(b) < CtrlMaxLine &&
+		(isCtrl(b) || bytes.HasPrefix([]byte(CtrlPrefix), b))
+}
+
+// handleCtrl handles a control command from a client. An optional
+// server resource info argument limits lock commands to the server
+// resource. A filter command sets filter rules of data to the client.
+func (h *Handler) handleCtrl(b []byte) {
+	line := string(bytes.TrimPrefix(b, []byte(CtrlPrefix)))
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		h.writeCtrl(ctrlMsg("error empty command"))
+		return
+	}
+	h.logger().Debugf("Res handler - %s - control command - %s", *h.res.GetInfo(), args)
+
+	switch args[0] {
+	case CtrlLock, CtrlUnlock:
+		for _, target := range h.getAllWriteTargets() {
+			if target.lock == nil {
+				continue
+			}
+			if len(args) > 1 && strings.Compare(args[1], *target.res.GetInfo()) != 0 {
+				continue
+			}
+
+			if strings.Compare(args[0], CtrlUnlock) == 0 {
+				target.lock.Release(h)
+				continue
+			}
+
+			if !target.lock.Acquire(h) {
+				h.writeCtrl(ctrlMsg("%s %s busy %s", CtrlLock, *target.res.GetInfo(),
+					getHolderInfo(target.lock.GetHolder())))
+			}
+		}
+
+	case CtrlFilter:
+		// No rule clears the filter. The rest of the line is parsed as
+		// rules, so expressions could have whitespace.
+		rules := splitFilterRules(strings.TrimRight(
+			strings.TrimPrefix(strings.TrimLeft(line, " \t"), CtrlFilter), "\r\n"))
+		if len(rules) == 0 {
+			h.SetWFilter(nil)
+			h.writeCtrl(ctrlMsg("%s ok", CtrlFilter))
+			return
+		}
+
+		f, err := NewFilter(rules)
+		if err != nil {
+			h.writeCtrl(ctrlMsg("error %s %s", CtrlFilter, err.Error()))
+			return
+		}
+		h.SetWFilter(f)
+		h.writeCtrl(ctrlMsg("%s ok", CtrlFilter))
+
+	default:
+		h.writeCtrl(ctrlMsg("error unknown command %s", args[0]))
+	}
+}
@@ -0,0 +1,52 @@
+package res
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCtrlLines checks control command lines are handled in data of
+// clients, and the rest of data is routed to server resources.
+func TestCtrlLines(t *testing.T) {
+	tests := []struct {
+		data string
+		srv  string // data written to the server, "" means none
+		msg  string // control message to the client, "" means none
+	}{
+		{data: "a\n#!sbps filter\nb\n", srv: "a\nb\n", msg: "#!sbps filter ok\n"},
+		// A control command split in reads
+		{data: "c\n#!sb", srv: "c\n"},
+		{data: "ps filter\nd", srv: "d", msg: "#!sbps filter ok\n"},
+		// A control command in the middle of a line is data
+		{data: "#!sbps filter\n", srv: "#!sbps filter\n"},
+		{data: "#!sbps filter\n", msg: "#!sbps filter ok\n"},
+		// A partial line which is not a control command is not kept
+		{data: "#!x", srv: "#!x"},
+	}
+
+	rw := byte((1 << ModeR) | (1 << ModeW))
+	srv, srvPeer := newTestMem(t, testName(t, "srv"), rw)
+	srv.Run()
+	client, clientPeer := newTestMem(t, testName(t, "client"), rw)
+	client.EnableCtrl()
+	client.Run()
+	link(srv, client)
+
+	for i, test := range tests {
+		clientPeer.write(t, test.data)
+
+		if test.srv != "" {
+			srvPeer.expect(t, test.srv)
+		} else {
+			srvPeer.expectNone(t, 50*time.Millisecond)
+		}
+		if test.msg != "" {
+			clientPeer.expect(t, test.msg)
+		} else {
+			clientPeer.expectNone(t, 10*time.Millisecond)
+		}
+		if t.Failed() {
+			t.Fatalf("Step %d is failed", i)
+		}
+	}
+}
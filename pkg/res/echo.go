@@ -0,0 +1,76 @@
+package res
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Echo suppression modes.
+const (
+	EchoWindow = "WINDOW"
+	EchoFrame  = "FRAME"
+)
+
+// ErrEcho is error instance for wrong echo suppression option.
+var ErrEcho = errors.New("Wrong echo suppression option")
+
+// Echo suppresses data echoed back by a server resource to the client
+// which wrote the data. In window mode, data read within the window after
+// a write is the echo. In frame mode, the first frame read after a write
+// is the echo.
+type Echo struct {
+	mode   string
+	window time.Duration
+
+	lock *sync.Mutex
+	src  *Handler
+	time time.Time
+}
+
+// NewEcho allocates and initializes an echo instance.
+func NewEcho(mode *string, window time.Duration) (*Echo, error) {
+	switch *mode {
+	case EchoWindow:
+		if window <= 0 {
+			return nil, ErrEcho
+		}
+	case EchoFrame:
+	default:
+		return nil, ErrEcho
+	}
+
+	return &Echo{
+		mode:   *mode,
+		window: window,
+
+		lock: &sync.Mutex{},
+		src:  nil,
+	}, nil
+}
+
+// Write records the client which writes to the server resource.
+func (e *Echo) Write(src *Handler) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.src = src
+	e.time = time.Now()
+}
+
+// Read returns the client which should not receive the read frame.
+func (e *Echo) Read() *Handler {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	src := e.src
+	if e.mode == EchoFrame {
+		e.src = nil
+		return src
+	}
+
+	if src != nil && time.Since(e.time) < e.window {
+		return src
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package res
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNewEcho checks echo suppression options.
+func TestNewEcho(t *testing.T) {
+	tests := []struct {
+		mode   string
+		window time.Duration
+		err    bool
+	}{
+		{mode: EchoWindow, window: 100 * time.Millisecond},
+		{mode: EchoWindow, window: 0, err: true},
+		{mode: EchoFrame},
+		{mode: "UNKNOWN", err: true},
+	}
+
+	for _, test := range tests {
+		_, err := NewEcho(&test.mode, test.window)
+		if (err != nil) != test.err {
+			t.Errorf("NewEcho(%s, %v) error - %v, want error %v", test.mode, test.window,
+				err, test.err)
+		}
+	}
+}
+
+// TestEcho checks data echoed back by a server resource is not delivered
+// to the client which wrote the data, and is delivered to other clients.
+func TestEcho(t *testing.T) {
+	tests := []struct {
+		mode   string
+		window time.Duration
+	}{
+		{mode: EchoFrame},
+		{mode: EchoWindow, window: 200 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			e, err := NewEcho(&test.mode, test.window)
+			if err != nil {
+				t.Fatalf("NewEcho() error - %v", err)
+			}
+			sResH, sPeer := newTestMem(t, testName(t, "server"), (1<<ModeR)|(1<<ModeW))
+			sResH.SetEcho(e)
+			sResH.Run()
+			c1ResH, c1Peer := newTestMemRW(t, testName(t, "client1"))
+			c2ResH, c2Peer := newTestMemRW(t, testName(t, "client2"))
+			link(sResH, c1ResH)
+			link(sResH, c2ResH)
+
+			c1Peer.write(t, "cmd\n")
+			sPeer.expect(t, "cmd\n")
+
+			// The echo is only delivered to the other client
+			sPeer.write(t, "cmd\n")
+			c2Peer.expect(t, "cmd\n")
+			c1Peer.expectNone(t, 50*time.Millisecond)
+
+			// Data after the echo is delivered to all clients
+			if test.window > 0 {
+				time.Sleep(test.window)
+			}
+			sPeer.write(t, "next\n")
+			c1Peer.expect(t, "next\n")
+			c2Peer.expect(t, "next\n")
+		})
+	}
+}
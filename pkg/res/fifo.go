@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"syscall"
 )
 
 // FIFO represents a FIFO (Named pipe).
@@ -76,6 +77,11 @@ func (res *FIFO) Write(b []byte) (n int, err error) {
 	return res.fp.Write(b)
 }
 
+// SyscallConn returns the raw connection of the FIFO.
+func (res *FIFO) SyscallConn() (syscall.RawConn, error) {
+	return res.fp.SyscallConn()
+}
+
 // IsOpen checks open of the resource.
 func (res *FIFO) IsOpen() bool {
 	res.isOpenLock.Lock()
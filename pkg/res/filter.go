@@ -0,0 +1,157 @@
+package res
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Filter actions and kinds. A filter rule is written as ACTION:KIND:EXPR
+// (ex. include:regex:ERROR, exclude:prefix:DEBUG, include:json:level=error).
+const (
+	FilterInclude = "include"
+	FilterExclude = "exclude"
+
+	FilterRegex  = "regex"
+	FilterPrefix = "prefix"
+	FilterJSON   = "json"
+
+	FilterMaxLine = 64 * 1024
+)
+
+// ErrFilter is error instance for wrong filter option.
+var ErrFilter = errors.New("Wrong filter option")
+
+// filterSplitRe matches whitespace before an action of a filter rule.
+var filterSplitRe = regexp.MustCompile(`\s+(` + FilterInclude + `|` + FilterExclude + `):`)
+
+// filterRule represents a rule of a filter.
+type filterRule struct {
+	include bool
+	kind    string
+
+	re     *regexp.Regexp
+	prefix []byte
+	field  []string
+	value  string
+}
+
+// match checks the line matches the rule.
+func (r *filterRule) match(line []byte) bool {
+	switch r.kind {
+	case FilterRegex:
+		return r.re.Match(line)
+	case FilterPrefix:
+		return bytes.HasPrefix(line, r.prefix)
+	case FilterJSON:
+		value, ok := getJSONField(line, r.field)
+		return ok && strings.Compare(value, r.value) == 0
+	}
+	return false
+}
+
+// Filter includes or excludes lines of frames. A line passes the filter
+// if it matches one of include rules, or there is no include rule, and
+// it matches no exclude rule.
+type Filter struct {
+	rules      []*filterRule
+	hasInclude bool
+}
+
+// NewFilter allocates and initializes a filter instance from rules.
+func NewFilter(specs []string) (*Filter, error) {
+	f := &Filter{}
+
+	for _, spec := range specs {
+		split := strings.SplitN(spec, ":", 3)
+		if len(split) != 3 {
+			return nil, ErrFilter
+		}
+
+		r := &filterRule{kind: split[1]}
+		switch split[0] {
+		case FilterInclude:
+			r.include = true
+			f.hasInclude = true
+		case FilterExclude:
+			r.include = false
+		default:
+			return nil, ErrFilter
+		}
+
+		switch split[1] {
+		case FilterRegex:
+			re, err := regexp.Compile(split[2])
+			if err != nil {
+				return nil, err
+			}
+			r.re = re
+		case FilterPrefix:
+			r.prefix = []byte(split[2])
+		case FilterJSON:
+			kv := strings.SplitN(split[2], "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, ErrFilter
+			}
+			r.field = strings.Split(kv[0], ".")
+			r.value = kv[1]
+		default:
+			return nil, ErrFilter
+		}
+
+		f.rules = append(f.rules, r)
+	}
+
+	return f, nil
+}
+
+// pass checks the line passes the filter.
+func (f *Filter) pass(line []byte) bool {
+	included := !f.hasInclude
+	for _, r := range f.rules {
+		if !r.match(bytes.TrimRight(line, "\r\n")) {
+			continue
+		}
+		if !r.include {
+			return false
+		}
+		included = true
+	}
+	return included
+}
+
+// Apply returns complete lines of the frame which pass the filter. The
+// trailing partial line is kept in rest and completed by the next frame
+// of the stream. A partial line longer than FilterMaxLine is filtered as
+// a line. If no line passes, Apply returns an empty slice.
+func (f *Filter) Apply(rest *[]byte, b []byte) []byte {
+	if len(f.rules) == 0 {
+		return b
+	}
+
+	var out []byte
+	for _, line := range splitLines(rest, b, FilterMaxLine) {
+		if f.pass(line) {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
+
+// splitFilterRules splits filter rules in a line. Rules are separated by
+// whitespace before an action, so an expression could have whitespace.
+func splitFilterRules(line string) []string {
+	line = strings.TrimLeft(line, " \t")
+	if line == "" {
+		return nil
+	}
+
+	var rules []string
+	start := 0
+	for _, loc := range filterSplitRe.FindAllStringSubmatchIndex(line, -1) {
+		rules = append(rules, line[start:loc[0]])
+		start = loc[2]
+	}
+	return append(rules, line[start:])
+}
@@ -0,0 +1,150 @@
+package res
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFilterApply checks lines of frames which pass filter rules, including
+// lines split across frames.
+func TestFilterApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []string
+		frames []string
+		want   []string
+		rest   string
+	}{
+		{
+			name:   "include regex",
+			rules:  []string{"include:regex:ERR"},
+			frames: []string{"ERR 1\nINFO 2\nERR 3\n"},
+			want:   []string{"ERR 1\nERR 3\n"},
+		},
+		{
+			name:   "exclude prefix",
+			rules:  []string{"exclude:prefix:DEBUG"},
+			frames: []string{"DEBUG 1\r\nINFO 2\r\n"},
+			want:   []string{"INFO 2\r\n"},
+		},
+		{
+			name:   "include json",
+			rules:  []string{"include:json:level=error"},
+			frames: []string{"{\"level\":\"error\"}\n{\"level\":\"info\"}\nbad\n"},
+			want:   []string{"{\"level\":\"error\"}\n"},
+		},
+		{
+			name:   "include and exclude",
+			rules:  []string{"include:prefix:E", "exclude:regex:ignore"},
+			frames: []string{"E 1\nE ignore\nI 2\n"},
+			want:   []string{"E 1\n"},
+		},
+		{
+			name:   "split line",
+			rules:  []string{"include:regex:^ERROR"},
+			frames: []string{"ER", "ROR 1\nINFO", " 2\nERROR", " 3\n"},
+			want:   []string{"", "ERROR 1\n", "", "ERROR 3\n"},
+		},
+		{
+			name:   "partial line is kept",
+			rules:  []string{"exclude:prefix:DEBUG"},
+			frames: []string{"INFO 1\nINFO 2"},
+			want:   []string{"INFO 1\n"},
+			rest:   "INFO 2",
+		},
+		{
+			name:   "long line",
+			rules:  []string{"include:prefix:L"},
+			frames: []string{"L" + strings.Repeat("x", FilterMaxLine), "y\n"},
+			want:   []string{"L" + strings.Repeat("x", FilterMaxLine), ""},
+		},
+		{
+			name:   "no rule",
+			frames: []string{"a", "b\n"},
+			want:   []string{"a", "b\n"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := NewFilter(test.rules)
+			if err != nil {
+				t.Fatalf("NewFilter() error - %v", err)
+			}
+
+			var rest []byte
+			for i, frame := range test.frames {
+				if got := f.Apply(&rest, []byte(frame)); string(got) != test.want[i] {
+					t.Errorf("Frame %d - Apply() is %q, want %q", i, got, test.want[i])
+				}
+			}
+			if string(rest) != test.rest {
+				t.Errorf("Rest is %q, want %q", rest, test.rest)
+			}
+		})
+	}
+}
+
+// TestSplitFilterRules checks rules of a control command are split before
+// actions, so expressions could have whitespace.
+func TestSplitFilterRules(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "", want: nil},
+		{line: "  ", want: nil},
+		{line: " include:regex:ERROR", want: []string{"include:regex:ERROR"}},
+		{
+			line: "include:regex:disk full exclude:prefix:DEBUG",
+			want: []string{"include:regex:disk full", "exclude:prefix:DEBUG"},
+		},
+		{
+			line: "include:regex:a  b\tinclude:json:msg=x y",
+			want: []string{"include:regex:a  b", "include:json:msg=x y"},
+		},
+		{
+			line: "include:regex:not include:this",
+			want: []string{"include:regex:not", "include:this"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := splitFilterRules(test.line); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitFilterRules(%q) is %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+// TestFilterHandler checks filters of data read from a server resource
+// and data written to a client set by a control command.
+func TestFilterHandler(t *testing.T) {
+	rw := byte((1 << ModeR) | (1 << ModeW))
+	f, err := NewFilter([]string{"exclude:prefix:DEBUG"})
+	if err != nil {
+		t.Fatalf("NewFilter() error - %v", err)
+	}
+	srv, srvPeer := newTestMem(t, testName(t, "srv"), rw)
+	srv.SetRFilter(f)
+	srv.Run()
+
+	client, clientPeer := newTestMem(t, testName(t, "client"), rw)
+	client.EnableCtrl()
+	client.Run()
+	link(srv, client)
+
+	srvPeer.write(t, "DEB")
+	srvPeer.write(t, "UG 1\nINFO 1\n")
+	clientPeer.expect(t, "INFO 1\n")
+
+	clientPeer.write(t, "#!sbps filter include:regex:disk (full|error)\n")
+	clientPeer.expect(t, "#!sbps filter ok\n")
+	srvPeer.write(t, "INFO disk full\nINFO disk ok\n")
+	clientPeer.expect(t, "INFO disk full\n")
+
+	clientPeer.write(t, "#!sbps filter\n")
+	clientPeer.expect(t, "#!sbps filter ok\n")
+	srvPeer.write(t, "INFO disk ok\n")
+	clientPeer.expect(t, "INFO disk ok\n")
+}
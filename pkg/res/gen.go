@@ -0,0 +1,221 @@
+package res
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generator patterns.
+const (
+	GenCounter = "COUNTER"
+	GenRandom  = "RANDOM"
+	GenFixed   = "FIXED"
+	GenTime    = "TIME"
+
+	GenArgSeparator = "/"
+	GenRandomSize   = 64
+)
+
+// ErrGen is error instance for wrong generator options.
+var ErrGen = errors.New("Wrong generator option")
+
+// Gen represents a read only resource which emits synthetic frames at
+// a rate. A frame of COUNTER is a sequence number and a newline, a frame of
+// RANDOM[/size] is random bytes, a frame of FIXED/payload is the payload
+// and a newline, and a frame of TIME[/size] is the emission time in unix
+// nanoseconds padded with spaces to the size including a newline. RANDOM
+// is seeded at open, so frames are the same after reopen.
+type Gen struct {
+	pattern string
+	arg     string
+	rate    float64
+	count   int
+
+	isOpenLock *sync.Mutex
+	isOpen     bool
+	quit       chan struct{}
+
+	seq     int
+	start   time.Time
+	random  *rand.Rand
+	size    int
+	pending []byte
+}
+
+// NewGen allocates and initializes a generator instance. pattern is
+// COUNTER, RANDOM[/size], FIXED/payload or TIME[/size], rate is frames
+// per second and count is the number of frames before EOF. 0 rate means
+// no rate limit, and 0 count means no end.
+func NewGen(pattern *string, rate float64, count int) (*Gen, error) {
+	name, arg := *pattern, ""
+	if i := strings.Index(name, GenArgSeparator); i >= 0 {
+		name, arg = name[:i], name[i+1:]
+	}
+
+	size := GenRandomSize
+	switch name {
+	case GenCounter:
+		if arg != "" {
+			return nil, ErrGen
+		}
+	case GenRandom, GenTime:
+		if arg != "" {
+			tmp, err := strconv.Atoi(arg)
+			if err != nil || tmp <= 0 {
+				return nil, ErrGen
+			}
+			size = tmp
+		}
+	case GenFixed:
+		if arg == "" {
+			return nil, ErrGen
+		}
+	default:
+		return nil, ErrGen
+	}
+
+	if rate < 0 || count < 0 {
+		return nil, ErrGen
+	}
+
+	return &Gen{
+		pattern: name,
+		arg:     arg,
+		rate:    rate,
+		count:   count,
+
+		isOpenLock: &sync.Mutex{},
+		isOpen:     false,
+
+		size: size,
+	}, nil
+}
+
+// Open starts generation from the first frame.
+func (res *Gen) Open() error {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == true {
+		return ErrALO
+	}
+
+	res.isOpen = true
+	res.quit = make(chan struct{})
+	res.seq = 0
+	res.start = time.Now()
+	res.random = rand.New(rand.NewSource(1))
+	res.pending = nil
+	return nil
+}
+
+// Close stops generation.
+func (res *Gen) Close() error {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == false {
+		return ErrALC
+	}
+
+	res.isOpen = false
+	close(res.quit)
+	return nil
+}
+
+// GetInfo get generator resource's info.
+func (res *Gen) GetInfo() *string {
+	pattern := res.pattern
+	if res.arg != "" {
+		pattern += GenArgSeparator + res.arg
+	}
+	tmp := fmt.Sprintf("%s:%s:%s", TypeGen, pattern, strconv.FormatFloat(res.rate, 'f', -1, 64))
+	if res.count > 0 {
+		tmp += ":" + strconv.Itoa(res.count)
+	}
+	return &tmp
+}
+
+// next returns the next frame.
+func (res *Gen) next() []byte {
+	switch res.pattern {
+	case GenCounter:
+		return []byte(strconv.Itoa(res.seq) + "\n")
+	case GenRandom:
+		b := make([]byte, res.size)
+		res.random.Read(b)
+		return b
+	case GenTime:
+		b := strconv.AppendInt(make([]byte, 0, res.size), time.Now().UnixNano(), 10)
+		for len(b) < res.size-1 {
+			b = append(b, ' ')
+		}
+		return append(b, '\n')
+	default:
+		return []byte(res.arg + "\n")
+	}
+}
+
+func (res *Gen) Read(b []byte) (n int, err error) {
+	if len(res.pending) > 0 {
+		n = copy(b, res.pending)
+		res.pending = res.pending[n:]
+		return n, nil
+	}
+
+	if res.count > 0 && res.seq >= res.count {
+		return 0, io.EOF
+	}
+
+	// Wait the time of the frame from the start
+	if res.rate > 0 {
+		due := res.start.Add(time.Duration(float64(res.seq) / res.rate * float64(time.Second)))
+		select {
+		case <-time.After(time.Until(due)):
+		case <-res.quit:
+			return 0, io.EOF
+		}
+	} else {
+		select {
+		case <-res.quit:
+			return 0, io.EOF
+		default:
+		}
+	}
+
+	frame := res.next()
+	res.seq++
+
+	n = copy(b, frame)
+	res.pending = frame[n:]
+	return n, nil
+}
+
+// Write discards data because generator is read only.
+func (res *Gen) Write(b []byte) (n int, err error) {
+	return len(b), nil
+}
+
+// IsOpen checks open of the resource.
+func (res *Gen) IsOpen() bool {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	return res.isOpen
+}
+
+// IsRable checks resource is readable.
+func (res *Gen) IsRable() bool {
+	return true
+}
+
+// IsWable check resource is writeable
+func (res *Gen) IsWable() bool {
+	return false
+}
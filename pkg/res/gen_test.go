@@ -0,0 +1,144 @@
+package res
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// readGen reads all frames of a generator until EOF.
+func readGen(t *testing.T, r *Gen) []byte {
+	t.Helper()
+
+	var out []byte
+	b := make([]byte, 5)
+	for {
+		n, err := r.Read(b)
+		out = append(out, b[:n]...)
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("Read() error - %v", err)
+		}
+	}
+}
+
+// TestGen checks frames of generator patterns with the count, and frames
+// are the same after reopen.
+func TestGen(t *testing.T) {
+	tests := []struct {
+		pattern string
+		count   int
+		want    string
+		size    int
+	}{
+		{pattern: "COUNTER", count: 3, want: "0\n1\n2\n"},
+		{pattern: "FIXED/hello", count: 2, want: "hello\nhello\n"},
+		{pattern: "RANDOM/8", count: 3, size: 24},
+		{pattern: "RANDOM", count: 2, size: 2 * GenRandomSize},
+		{pattern: "TIME/32", count: 2, size: 64},
+	}
+
+	for _, test := range tests {
+		r, err := NewGen(&test.pattern, 0, test.count)
+		if err != nil {
+			t.Errorf("NewGen(%q) error - %v", test.pattern, err)
+			continue
+		}
+
+		var frames [][]byte
+		for i := 0; i < 2; i++ {
+			if err := r.Open(); err != nil {
+				t.Fatalf("Open() of %q error - %v", test.pattern, err)
+			}
+			frames = append(frames, readGen(t, r))
+			r.Close()
+		}
+
+		got := frames[0]
+		if test.want != "" && string(got) != test.want {
+			t.Errorf("Frames of %q are %q, want %q", test.pattern, got, test.want)
+		}
+		if test.size > 0 && len(got) != test.size {
+			t.Errorf("Frames of %q are %d bytes, want %d", test.pattern, len(got), test.size)
+		}
+		if test.pattern != "TIME/32" && !bytes.Equal(frames[0], frames[1]) {
+			t.Errorf("Frames of %q differ after reopen", test.pattern)
+		}
+	}
+}
+
+// TestGenRate checks frames are emitted at the rate, and Close stops a
+// read waiting the next frame.
+func TestGenRate(t *testing.T) {
+	pattern := GenCounter
+	r, err := NewGen(&pattern, 20, 3)
+	if err != nil {
+		t.Fatalf("NewGen() error - %v", err)
+	}
+	if err := r.Open(); err != nil {
+		t.Fatalf("Open() error - %v", err)
+	}
+
+	// Frames are at 0, 50 and 100 milliseconds
+	start := time.Now()
+	if got := readGen(t, r); string(got) != "0\n1\n2\n" {
+		t.Errorf("Frames are %q, want %q", got, "0\n1\n2\n")
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("Frames are read in %v, want at least 100ms", d)
+	}
+	r.Close()
+
+	r, _ = NewGen(&pattern, 0.1, 0)
+	r.Open()
+	b := make([]byte, 16)
+	r.Read(b)
+
+	done := make(chan error)
+	go func() {
+		_, err := r.Read(b)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	r.Close()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Read() after Close() error - %v, want EOF", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("Read() is not stopped by Close()")
+	}
+}
+
+// TestNewGen checks wrong generator options.
+func TestNewGen(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rate    float64
+		count   int
+		err     bool
+	}{
+		{pattern: "COUNTER"},
+		{pattern: "COUNTER/1", err: true},
+		{pattern: "RANDOM/0", err: true},
+		{pattern: "RANDOM/x", err: true},
+		{pattern: "TIME/16"},
+		{pattern: "FIXED", err: true},
+		{pattern: "FIXED/a/b"},
+		{pattern: "UNKNOWN", err: true},
+		{pattern: "COUNTER", rate: -1, err: true},
+		{pattern: "COUNTER", count: -1, err: true},
+	}
+
+	for _, test := range tests {
+		_, err := NewGen(&test.pattern, test.rate, test.count)
+		if (err != nil) != test.err {
+			t.Errorf("NewGen(%q, %v, %d) error - %v, want error %v", test.pattern,
+				test.rate, test.count, err, test.err)
+		}
+	}
+}
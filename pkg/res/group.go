@@ -0,0 +1,273 @@
+package res
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Group policies and options.
+const (
+	GroupFailover     = "FAILOVER"
+	GroupBroadcast    = "BROADCAST"
+	GroupRoundRobin   = "ROUNDROBIN"
+	GroupRandom       = "RANDOM"
+	GroupLeastPending = "LEASTPENDING"
+	GroupHash         = "HASH"
+
+	GroupOptFailback = "FAILBACK"
+)
+
+// ErrGroup is error instance for wrong group option.
+var ErrGroup = errors.New("Wrong group option")
+
+// GroupStatus represents status of a group.
+type GroupStatus struct {
+	Name         string    `json:"name"`
+	Policy       string    `json:"policy"`
+	Failback     bool      `json:"failback"`
+	Active       string    `json:"active"`
+	Members      []string  `json:"members"`
+	Failovers    int       `json:"failovers"`
+	LastFailover time.Time `json:"lastFailover"`
+}
+
+// Hoster is implemented by client resources which know the host of the
+// client. Clients of the same host are hashed to the same member.
+type Hoster interface {
+	GetHost() string
+}
+
+// getHost returns the host of a client resource handler for hashing.
+// Info is used for resources which do not know the host.
+func getHost(h *Handler) string {
+	if hoster, ok := h.res.(Hoster); ok {
+		return hoster.GetHost()
+	}
+	return *h.res.GetInfo()
+}
+
+// Group represents ordered server resource handlers. In a failover group,
+// only the active member is read from and written to. In other groups,
+// all members are read from and a client write is distributed to
+// members depends on the group policy.
+type Group struct {
+	name     string
+	policy   string
+	failback bool
+
+	lock         *sync.Mutex
+	members      []*Handler
+	open         []*Handler
+	active       *Handler
+	next         int
+	failovers    int
+	lastFailover time.Time
+}
+
+// NewGroup allocates and initializes a group instance.
+func NewGroup(name *string, policy *string, opts []string) (*Group, error) {
+	if *name == "" {
+		return nil, ErrGroup
+	}
+
+	g := &Group{
+		name:     *name,
+		policy:   *policy,
+		failback: false,
+
+		lock:    &sync.Mutex{},
+		members: nil,
+		open:    nil,
+		active:  nil,
+	}
+
+	switch *policy {
+	case GroupFailover, GroupBroadcast, GroupRoundRobin, GroupRandom,
+		GroupLeastPending, GroupHash:
+	default:
+		return nil, ErrGroup
+	}
+
+	for _, opt := range opts {
+		if strings.Compare(opt, GroupOptFailback) == 0 &&
+			strings.Compare(*policy, GroupFailover) == 0 {
+			g.failback = true
+		} else {
+			return nil, ErrGroup
+		}
+	}
+
+	return g, nil
+}
+
+// GetName returns group's name.
+func (g *Group) GetName() *string {
+	return &g.name
+}
+
+// AddMember appends a server resource handler to the group in order.
+func (g *Group) AddMember(h *Handler) {
+	h.logger().Infof("Add the group member - %s - %s", g.name, *h.GetRes().GetInfo())
+
+	g.lock.Lock()
+	g.members = append(g.members, h)
+	g.lock.Unlock()
+
+	h.SetGroup(g)
+	g.Update()
+}
+
+// IsActive checks the handler is the active member. All members are
+// active except in a failover group.
+func (g *Group) IsActive(h *Handler) bool {
+	if strings.Compare(g.policy, GroupFailover) != 0 {
+		return true
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.active == h
+}
+
+// Select selects members to write among members linked to the source
+// handler depends on the group policy. Only open and writable members are
+// selected.
+func (g *Group) Select(src *Handler, linked map[*Handler]struct{}) []*Handler {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if strings.Compare(g.policy, GroupFailover) == 0 {
+		if _, exist := linked[g.active]; exist && g.active.res.IsOpen() {
+			return []*Handler{g.active}
+		}
+		return nil
+	}
+
+	// Keep order of members. Members closed after the last update are
+	// skipped until the next update.
+	var members []*Handler
+	for _, member := range g.open {
+		if _, exist := linked[member]; exist && member.res.IsOpen() {
+			members = append(members, member)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	switch g.policy {
+	case GroupRoundRobin:
+		i := g.next % len(members)
+		g.next = (i + 1) % len(members)
+		return members[i : i+1]
+
+	case GroupRandom:
+		i := rand.Intn(len(members))
+		return members[i : i+1]
+
+	case GroupLeastPending:
+		least := members[0]
+		for _, member := range members[1:] {
+			if member.GetPending() < least.GetPending() {
+				least = member
+			}
+		}
+		return []*Handler{least}
+
+	case GroupHash:
+		hash := fnv.New32a()
+		hash.Write([]byte(getHost(src)))
+		i := int(hash.Sum32() % uint32(len(members)))
+		return members[i : i+1]
+
+	default:
+		return members
+	}
+}
+
+// Update updates open and writable members, and selects the active member
+// depends on open states of members in a failover group. The active member
+// is kept while it is open unless fail-back is set.
+func (g *Group) Update() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.open = nil
+	for _, member := range g.members {
+		if member.res.IsOpen() && member.res.IsWable() {
+			g.open = append(g.open, member)
+		}
+	}
+
+	if strings.Compare(g.policy, GroupFailover) != 0 || len(g.members) == 0 {
+		return
+	}
+
+	// Find start index
+	start := 0
+	if !g.failback {
+		for i, member := range g.members {
+			if member == g.active {
+				if member.GetRes().IsOpen() {
+					return
+				}
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	// Find the next open member
+	var next *Handler
+	for i := 0; i < len(g.members); i++ {
+		member := g.members[(start+i)%len(g.members)]
+		if member.GetRes().IsOpen() {
+			next = member
+			break
+		}
+	}
+
+	if next == g.active {
+		return
+	}
+
+	if g.active == nil {
+		next.logger().Infof("Activate the group member - %s - %s", g.name, *next.GetRes().GetInfo())
+	} else if next == nil {
+		g.active.logger().Errorf("Failover the group failed - %s - No open member", g.name)
+	} else {
+		next.logger().Warnf("Failover the group - %s - %s -> %s", g.name,
+			*g.active.GetRes().GetInfo(), *next.GetRes().GetInfo())
+		g.failovers++
+		g.lastFailover = time.Now()
+	}
+	g.active = next
+}
+
+// GetStatus returns status of the group.
+func (g *Group) GetStatus() *GroupStatus {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	status := &GroupStatus{
+		Name:         g.name,
+		Policy:       g.policy,
+		Failback:     g.failback,
+		Members:      []string{},
+		Failovers:    g.failovers,
+		LastFailover: g.lastFailover,
+	}
+	if g.active != nil {
+		status.Active = *g.active.GetRes().GetInfo()
+	}
+	for _, member := range g.members {
+		status.Members = append(status.Members, *member.GetRes().GetInfo())
+	}
+
+	return status
+}
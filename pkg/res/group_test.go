@@ -0,0 +1,315 @@
+package res
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testHostRes is a memory resource of a client with a host.
+type testHostRes struct {
+	*Mem
+	host string
+}
+
+// GetHost returns the host of the client.
+func (res *testHostRes) GetHost() string {
+	return res.host
+}
+
+// newTestClient returns a handler of a client resource with the host and
+// the port.
+func newTestClient(t *testing.T, host string, port string) *Handler {
+	name := testName(t, host+"-"+port)
+	return NewHandler(&testHostRes{Mem: NewMem(&name, (1<<ModeR)|(1<<ModeW)), host: host}, nil)
+}
+
+// TestGroupFailover checks the active member of a failover group follows
+// open states of members with and without fail-back.
+func TestGroupFailover(t *testing.T) {
+	type step struct {
+		open   []int
+		close  []int
+		active int // -1 means no active member
+	}
+
+	tests := []struct {
+		name     string
+		failback bool
+		steps    []step
+	}{
+		{
+			name: "failover",
+			steps: []step{
+				{active: 0},
+				{close: []int{0}, active: 1},
+				{open: []int{0}, active: 1},
+				{close: []int{1}, active: 2},
+				{close: []int{2}, active: 0},
+				{close: []int{0}, active: -1},
+				{open: []int{2}, active: 2},
+			},
+		},
+		{
+			name:     "failback",
+			failback: true,
+			steps: []step{
+				{active: 0},
+				{close: []int{0}, active: 1},
+				{open: []int{0}, active: 0},
+				{close: []int{1, 2}, active: 0},
+				{close: []int{0}, active: -1},
+				{open: []int{1, 2}, active: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := testName(t, "group")
+			policy := GroupFailover
+			var opts []string
+			if test.failback {
+				opts = []string{GroupOptFailback}
+			}
+			g, err := NewGroup(&name, &policy, opts)
+			if err != nil {
+				t.Fatalf("NewGroup() error - %v", err)
+			}
+
+			var members []*Handler
+			for _, m := range []string{"a", "b", "c"} {
+				h, _ := newTestMem(t, testName(t, m), (1<<ModeR)|(1<<ModeW))
+				g.AddMember(h)
+				members = append(members, h)
+			}
+
+			for i, s := range test.steps {
+				for _, m := range s.close {
+					members[m].GetRes().Close()
+				}
+				for _, m := range s.open {
+					members[m].GetRes().Open()
+				}
+				g.Update()
+
+				for m, h := range members {
+					if want := m == s.active; g.IsActive(h) != want {
+						t.Errorf("Step %d - IsActive() of member %d is %v, want %v",
+							i, m, !want, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestGroupFailoverRoute checks only the active member of a failover
+// group is read from and written to.
+func TestGroupFailoverRoute(t *testing.T) {
+	name := testName(t, "group")
+	policy := GroupFailover
+	g, err := NewGroup(&name, &policy, nil)
+	if err != nil {
+		t.Fatalf("NewGroup() error - %v", err)
+	}
+
+	// Groups are set before handlers run
+	rw := byte((1 << ModeR) | (1 << ModeW))
+	primary, primaryPeer := newTestMem(t, testName(t, "primary"), rw)
+	backup, backupPeer := newTestMem(t, testName(t, "backup"), rw)
+	g.AddMember(primary)
+	g.AddMember(backup)
+	primary.Run()
+	backup.Run()
+
+	client, clientPeer := newTestMemRW(t, testName(t, "client"))
+	link(primary, client)
+	link(backup, client)
+
+	// Only the primary is active
+	clientPeer.write(t, "cmd1\n")
+	primaryPeer.expect(t, "cmd1\n")
+	backupPeer.expectNone(t, 50*time.Millisecond)
+
+	backupPeer.write(t, "backup\n")
+	primaryPeer.write(t, "primary\n")
+	clientPeer.expect(t, "primary\n")
+	// Data of the inactive backup is dropped before the backup is active
+	clientPeer.expectNone(t, 50*time.Millisecond)
+
+	// The backup is active after the primary is closed
+	primary.GetRes().Close()
+	g.Update()
+
+	clientPeer.write(t, "cmd2\n")
+	backupPeer.expect(t, "cmd2\n")
+	backupPeer.write(t, "backup\n")
+	clientPeer.expect(t, "backup\n")
+}
+
+// TestGroupSelect checks members selected for client writes by the
+// policies of a group.
+func TestGroupSelect(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		closed  []int
+		pending []int32
+		clients [][2]string // host and port of each write
+		want    [][]int     // selected members of each write
+	}{
+		{
+			name:    "roundrobin",
+			policy:  GroupRoundRobin,
+			clients: [][2]string{{"a", "1"}, {"a", "1"}, {"a", "1"}, {"a", "1"}},
+			want:    [][]int{{0}, {1}, {2}, {0}},
+		},
+		{
+			name:    "roundrobin skips closed",
+			policy:  GroupRoundRobin,
+			closed:  []int{1},
+			clients: [][2]string{{"a", "1"}, {"a", "1"}, {"a", "1"}},
+			want:    [][]int{{0}, {2}, {0}},
+		},
+		{
+			name:    "broadcast",
+			policy:  GroupBroadcast,
+			closed:  []int{2},
+			clients: [][2]string{{"a", "1"}},
+			want:    [][]int{{0, 1}},
+		},
+		{
+			name:    "leastpending",
+			policy:  GroupLeastPending,
+			pending: []int32{3, 1, 2},
+			clients: [][2]string{{"a", "1"}, {"b", "2"}},
+			want:    [][]int{{1}, {1}},
+		},
+		{
+			name:    "failover",
+			policy:  GroupFailover,
+			closed:  []int{0},
+			clients: [][2]string{{"a", "1"}},
+			want:    [][]int{{1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := testName(t, "group")
+			g, err := NewGroup(&name, &test.policy, nil)
+			if err != nil {
+				t.Fatalf("NewGroup() error - %v", err)
+			}
+
+			var members []*Handler
+			linked := make(map[*Handler]struct{})
+			for i, m := range []string{"a", "b", "c"} {
+				h, _ := newTestMem(t, testName(t, m), (1<<ModeR)|(1<<ModeW))
+				if i < len(test.pending) {
+					atomic.StoreInt32(&h.pending, test.pending[i])
+				}
+				g.AddMember(h)
+				members = append(members, h)
+				linked[h] = struct{}{}
+			}
+			for _, m := range test.closed {
+				members[m].GetRes().Close()
+			}
+			g.Update()
+
+			for i, c := range test.clients {
+				got := g.Select(newTestClient(t, c[0], c[1]), linked)
+				if len(got) != len(test.want[i]) {
+					t.Fatalf("Write %d - selected %d members, want %v", i, len(got), test.want[i])
+				}
+				for j, m := range test.want[i] {
+					if got[j] != members[m] {
+						t.Errorf("Write %d - selected member %d is wrong, want %d", i, j, m)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestGroupHash checks clients of the same host are selected to the same
+// member regardless of ports, and members not linked are not selected.
+func TestGroupHash(t *testing.T) {
+	name := testName(t, "group")
+	policy := GroupHash
+	g, err := NewGroup(&name, &policy, nil)
+	if err != nil {
+		t.Fatalf("NewGroup() error - %v", err)
+	}
+
+	linked := make(map[*Handler]struct{})
+	for _, m := range []string{"a", "b", "c", "d"} {
+		h, _ := newTestMem(t, testName(t, m), (1<<ModeR)|(1<<ModeW))
+		g.AddMember(h)
+		linked[h] = struct{}{}
+	}
+
+	for _, host := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		var first *Handler
+		for _, port := range []string{"40000", "40001", "51234", "60000"} {
+			got := g.Select(newTestClient(t, host, port), linked)
+			if len(got) != 1 {
+				t.Fatalf("Host %s port %s - selected %d members, want 1", host, port, len(got))
+			}
+			if first == nil {
+				first = got[0]
+			} else if got[0] != first {
+				t.Errorf("Host %s port %s - selected member is changed", host, port)
+			}
+		}
+
+		// Unlinked members are never selected
+		if got := g.Select(newTestClient(t, host, "1"), map[*Handler]struct{}{}); len(got) != 0 {
+			t.Errorf("Host %s - selected %d unlinked members, want 0", host, len(got))
+		}
+	}
+}
+
+// TestGroupWriteTargets checks write targets of a client are updated by
+// linking and unlinking members, and only selected members are written.
+func TestGroupWriteTargets(t *testing.T) {
+	name := testName(t, "group")
+	policy := GroupRoundRobin
+	g, err := NewGroup(&name, &policy, nil)
+	if err != nil {
+		t.Fatalf("NewGroup() error - %v", err)
+	}
+
+	rw := byte((1 << ModeR) | (1 << ModeW))
+	a, aPeer := newTestMem(t, testName(t, "a"), rw)
+	b, bPeer := newTestMem(t, testName(t, "b"), rw)
+	direct, directPeer := newTestMemRW(t, testName(t, "direct"))
+	g.AddMember(a)
+	g.AddMember(b)
+	a.Run()
+	b.Run()
+
+	client, clientPeer := newTestMemRW(t, testName(t, "client"))
+	link(a, client)
+	link(b, client)
+	link(direct, client)
+
+	clientPeer.write(t, "1\n")
+	aPeer.expect(t, "1\n")
+	directPeer.expect(t, "1\n")
+	clientPeer.write(t, "2\n")
+	bPeer.expect(t, "2\n")
+	directPeer.expect(t, "2\n")
+
+	// Only the linked member is selected after unlinking
+	client.RemoveWriteTarget(a)
+	client.RemoveWriteTarget(direct)
+	for _, data := range []string{"3\n", "4\n"} {
+		clientPeer.write(t, data)
+		bPeer.expect(t, data)
+	}
+	aPeer.expectNone(t, 50*time.Millisecond)
+	directPeer.expectNone(t, 0)
+}
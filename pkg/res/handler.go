@@ -1,9 +1,13 @@
 package res
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ssup2/sbps/pkg/log"
 )
@@ -12,17 +16,39 @@ import (
 const (
 	ReadBufSize      = 4096
 	WriteChannelSize = 16
+	WriteQueueSize   = 256
+)
+
+// Write queue policies.
+const (
+	WriteDrop       = "DROP"
+	WriteDisconnect = "DISCONNECT"
 )
 
 // ErrNR is error instance when res handler is not running
 var ErrNR = errors.New("Handler is not running")
 
+// ErrWQueue is error instance for wrong write queue option.
+var ErrWQueue = errors.New("Wrong write queue option")
+
+// Deadliner is implemented by resources which support write deadlines.
+type Deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
 // WriteResult represents result of a write function.
 type WriteResult struct {
 	n   int
 	err *error
 }
 
+// wItem represents data in the write queue. buf is the read buffer which
+// data refers to, and it is released after data is written.
+type wItem struct {
+	data []byte
+	buf  *Buf
+}
+
 // Handler manages goroutines to read from a resource or write to resource.
 type Handler struct {
 	res Res
@@ -34,11 +60,54 @@ type Handler struct {
 	wChanData   chan []byte
 	wChanResult chan *WriteResult
 	isRun       bool
+	pending     int32
+	wQueue      chan wItem
+	wPolicy     string
+	drops       int64
 
 	wTargetsLock *sync.Mutex
 	wTargets     map[*Handler]struct{}
+	wDirect      []*Handler
+	wGroups      map[*Group]map[*Handler]struct{}
+	wLock        *sync.Mutex
+	noSplice     bool
+	spliceValid  bool
+	spliceGen    uint32
+	spliceTarget *Handler
+
+	group  *Group
+	corr   *Correlator
+	lock   *Lock
+	echo   *Echo
+	isCtrl bool
+
+	// ctrlRest is the partial line which could be a control command, and
+	// ctrlMid means data read last ends in the middle of a line.
+	ctrlRest []byte
+	ctrlMid  bool
+
+	filterLock *sync.RWMutex
+	rFilter    *Filter
+	wFilter    *Filter
+	rRest      []byte
+	wRests     map[*Handler][]byte
+
+	transLock   *sync.Mutex
+	rTrans      Chain
+	wTrans      Chain
+	rTransRest  []byte
+	wTransRests map[*Handler][]byte
+
+	limiter  *Limiter
+	bufPool  *BufPool
+	wTimeout time.Duration
+	taps     []Tap
+
+	interceptors []Interceptor
 
 	closeNoti chan *Handler
+	closed    chan struct{}
+	closeOnce *sync.Once
 }
 
 // NewHandler allocates and initializes a handler instance.
@@ -53,21 +122,62 @@ func NewHandler(res Res, closeNoti chan *Handler) *Handler {
 		wChanData:   make(chan []byte),
 		wChanResult: make(chan *WriteResult),
 		isRun:       false,
+		pending:     0,
+		wQueue:      nil,
+		wPolicy:     WriteDrop,
+		drops:       0,
 
 		wTargetsLock: &sync.Mutex{},
 		wTargets:     make(map[*Handler]struct{}),
+		wDirect:      nil,
+		wGroups:      nil,
+		wLock:        &sync.Mutex{},
+		noSplice:     false,
+		spliceValid:  false,
+		spliceGen:    0,
+		spliceTarget: nil,
+
+		group:  nil,
+		corr:   nil,
+		lock:   nil,
+		echo:   nil,
+		isCtrl: false,
+
+		ctrlRest: nil,
+		ctrlMid:  false,
+
+		filterLock: &sync.RWMutex{},
+		rFilter:    nil,
+		wFilter:    nil,
+		rRest:      nil,
+		wRests:     make(map[*Handler][]byte),
+
+		transLock:   &sync.Mutex{},
+		rTrans:      nil,
+		wTrans:      nil,
+		rTransRest:  nil,
+		wTransRests: make(map[*Handler][]byte),
+
+		limiter:  nil,
+		bufPool:  GetBufPool(ReadBufSize),
+		wTimeout: 0,
+		taps:     nil,
+
+		interceptors: nil,
 
 		closeNoti: closeNoti,
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
 	}
 }
 
-// Close deinit and clean the handler.
+// Close deinit and clean the handler, and closes the resource.
 func (h *Handler) Close() {
 	// Stop goroutines and close write channel
 	h.isRunLock.Lock()
+	wasRun := h.isRun
 	if h.isRun == true {
-		h.rQuit <- struct{}{}
-		h.wQuit <- struct{}{}
+		h.quit()
 		close(h.rQuit)
 		close(h.wQuit)
 
@@ -77,10 +187,23 @@ func (h *Handler) Close() {
 	h.isRun = false
 	h.isRunLock.Unlock()
 
+	if wasRun {
+		h.interceptClose()
+	}
+
 	// Clear write targets
 	h.wTargetsLock.Lock()
 	h.wTargets = nil
+	h.wDirect = nil
+	h.wGroups = nil
 	h.wTargetsLock.Unlock()
+	invalidateSplice()
+
+	// Close the resource and stop waiting close events
+	h.closeOnce.Do(func() {
+		h.res.Close()
+		close(h.closed)
+	})
 }
 
 // GetRes returns handler's resource
@@ -88,9 +211,234 @@ func (h *Handler) GetRes() Res {
 	return h.res
 }
 
+// SetGroup sets the group which the handler belongs to.
+func (h *Handler) SetGroup(g *Group) {
+	h.group = g
+}
+
+// GetGroup returns the group which the handler belongs to.
+func (h *Handler) GetGroup() *Group {
+	return h.group
+}
+
+// SetCorrelator sets the correlator which routes responses of the resource.
+func (h *Handler) SetCorrelator(c *Correlator) {
+	h.corr = c
+}
+
+// SetLock sets the lock which arbitrates writes of clients.
+func (h *Handler) SetLock(l *Lock) {
+	l.owner = h
+	h.lock = l
+}
+
+// SetEcho sets the echo suppression of the resource.
+func (h *Handler) SetEcho(e *Echo) {
+	h.echo = e
+}
+
+// SetRFilter sets the filter of data read from the resource.
+func (h *Handler) SetRFilter(f *Filter) {
+	h.filterLock.Lock()
+	defer h.filterLock.Unlock()
+
+	h.rFilter = f
+	h.rRest = nil
+	invalidateSplice()
+}
+
+// SetWFilter sets the filter of data written to the resource.
+func (h *Handler) SetWFilter(f *Filter) {
+	h.filterLock.Lock()
+	defer h.filterLock.Unlock()
+
+	h.wFilter = f
+	h.wRests = make(map[*Handler][]byte)
+	invalidateSplice()
+}
+
+// SetRTransform sets the transform chain of data read from the resource.
+func (h *Handler) SetRTransform(c Chain) {
+	h.transLock.Lock()
+	defer h.transLock.Unlock()
+
+	h.rTrans = c
+	h.rTransRest = nil
+}
+
+// SetWTransform sets the transform chain of data written to the resource.
+func (h *Handler) SetWTransform(c Chain) {
+	h.transLock.Lock()
+	defer h.transLock.Unlock()
+
+	h.wTrans = c
+	h.wTransRests = make(map[*Handler][]byte)
+}
+
+// applyRTransform transforms complete lines of data read from the
+// resource. The partial line of data is kept until the rest of the line
+// is read.
+func (h *Handler) applyRTransform(b []byte) []byte {
+	h.transLock.Lock()
+	c := h.rTrans
+	lines := splitLines(&h.rTransRest, b, TransMaxLine)
+	h.transLock.Unlock()
+
+	var out []byte
+	for _, line := range lines {
+		out = append(out, c.Apply(h, line)...)
+	}
+	return out
+}
+
+// applyWTransform transforms complete lines of data written to the
+// resource. Partial lines are kept for each source handler, because data
+// of sources are interleaved. Data without the source handler is
+// transformed as data from the handler.
+func (h *Handler) applyWTransform(src *Handler, b []byte) []byte {
+	h.transLock.Lock()
+	c := h.wTrans
+	rest := h.wTransRests[src]
+	lines := splitLines(&rest, b, TransMaxLine)
+	if len(rest) > 0 {
+		h.wTransRests[src] = rest
+	} else {
+		delete(h.wTransRests, src)
+	}
+	h.transLock.Unlock()
+
+	from := src
+	if from == nil {
+		from = h
+	}
+	var out []byte
+	for _, line := range lines {
+		out = append(out, c.Apply(from, line)...)
+	}
+	return out
+}
+
+// SetLimiter sets the rate limiter of data read from the resource.
+func (h *Handler) SetLimiter(l *Limiter) {
+	h.limiter = l
+}
+
+// SetReadBufSize sets the size of read buffers. It must be set before Run.
+func (h *Handler) SetReadBufSize(size int) {
+	h.bufPool = GetBufPool(size)
+}
+
+// SetWriteTimeout sets the write deadline of each write to the resource.
+// If the resource misses the deadline, the handler is closed.
+func (h *Handler) SetWriteTimeout(timeout time.Duration) {
+	h.wTimeout = timeout
+}
+
+// SetWriteQueue sets the write queue of the size. Writes to the handler
+// are queued without waiting, so a slow resource does not block writers.
+// When the queue is full, data is dropped in DROP policy, or the resource
+// is disconnected in DISCONNECT policy. It must be set before Run.
+func (h *Handler) SetWriteQueue(size int, policy *string) error {
+	if size <= 0 {
+		return ErrWQueue
+	}
+	switch *policy {
+	case WriteDrop, WriteDisconnect:
+	default:
+		return ErrWQueue
+	}
+
+	h.wQueue = make(chan wItem, size)
+	h.wPolicy = *policy
+	return nil
+}
+
+// GetDrops returns the number of writes dropped by the full write queue.
+func (h *Handler) GetDrops() int64 {
+	return atomic.LoadInt64(&h.drops)
+}
+
+// AddTap adds a tap of data read from and written to the resource.
+// It must be added before Run.
+func (h *Handler) AddTap(t Tap) {
+	h.taps = append(h.taps, t)
+}
+
+// getFilters returns filters of the handler.
+func (h *Handler) getFilters() (rFilter *Filter, wFilter *Filter) {
+	h.filterLock.RLock()
+	defer h.filterLock.RUnlock()
+
+	return h.rFilter, h.wFilter
+}
+
+// applyRFilter filters data read from the resource. The partial line of
+// data is kept until the rest of the line is read.
+func (h *Handler) applyRFilter(b []byte) []byte {
+	h.filterLock.Lock()
+	defer h.filterLock.Unlock()
+
+	if h.rFilter == nil {
+		return b
+	}
+	return h.rFilter.Apply(&h.rRest, b)
+}
+
+// applyWFilter filters data written to the resource. Partial lines are
+// kept for each source handler, because data of sources are interleaved.
+func (h *Handler) applyWFilter(src *Handler, b []byte) []byte {
+	h.filterLock.Lock()
+	defer h.filterLock.Unlock()
+
+	if h.wFilter == nil {
+		return b
+	}
+	rest := h.wRests[src]
+	b = h.wFilter.Apply(&rest, b)
+	if len(rest) > 0 {
+		h.wRests[src] = rest
+	} else {
+		delete(h.wRests, src)
+	}
+	return b
+}
+
+// ReleaseLock releases the lock if the client handler holds the lock.
+func (h *Handler) ReleaseLock(cResH *Handler) {
+	if h.lock != nil {
+		h.lock.Release(cResH)
+	}
+}
+
+// EnableCtrl enables control commands from the resource.
+func (h *Handler) EnableCtrl() {
+	h.isCtrl = true
+}
+
+// logger returns the logger with fields of the handler. Info of client
+// resources is logged as the client field.
+func (h *Handler) logger() *log.Entry {
+	fields := log.Fields{Component: log.CompHandler}
+	switch h.res.(type) {
+	case *Conn, *HTTP:
+		fields.Client = *h.res.GetInfo()
+	default:
+		fields.Res = *h.res.GetInfo()
+	}
+	return log.With(fields)
+}
+
+// isRunning checks the handler is running.
+func (h *Handler) isRunning() bool {
+	h.isRunLock.RLock()
+	defer h.isRunLock.RUnlock()
+
+	return h.isRun
+}
+
 // AddWriteTarget adds a write target handler.
 func (h *Handler) AddWriteTarget(target *Handler) {
-	log.Infof("Add the write target - %s", *h.res.GetInfo())
+	h.logger().Infof("Add the write target - %s", *h.res.GetInfo())
 
 	h.wTargetsLock.Lock()
 	defer h.wTargetsLock.Unlock()
@@ -100,11 +448,13 @@ func (h *Handler) AddWriteTarget(target *Handler) {
 		return
 	}
 	h.wTargets[target] = struct{}{}
+	h.updateWriteTargets()
+	invalidateSplice()
 }
 
 // RemoveWriteTarget remove a write target handler.
 func (h *Handler) RemoveWriteTarget(target *Handler) {
-	log.Infof("Remove the write target - %s", *h.res.GetInfo())
+	h.logger().Infof("Remove the write target - %s", *h.res.GetInfo())
 
 	h.wTargetsLock.Lock()
 	defer h.wTargetsLock.Unlock()
@@ -114,133 +464,589 @@ func (h *Handler) RemoveWriteTarget(target *Handler) {
 		return
 	}
 	delete(h.wTargets, target)
+	h.updateWriteTargets()
+	invalidateSplice()
 }
 
-// Write send data to write goroutine through the white channel.
-func (h *Handler) Write(b []byte) (n int, err error) {
+// updateWriteTargets splits write targets into targets without a group and
+// members of each group, so reads do not build them. They are replaced
+// instead of modified because readers use them without the lock. It must be
+// called with wTargetsLock.
+func (h *Handler) updateWriteTargets() {
+	var direct []*Handler
+	groups := make(map[*Group]map[*Handler]struct{})
+	for target := range h.wTargets {
+		if target.group == nil {
+			direct = append(direct, target)
+			continue
+		}
+		if _, exist := groups[target.group]; !exist {
+			groups[target.group] = make(map[*Handler]struct{})
+		}
+		groups[target.group][target] = struct{}{}
+	}
+	h.wDirect = direct
+	h.wGroups = groups
+}
+
+// getAllWriteTargets returns all write targets of the handler.
+func (h *Handler) getAllWriteTargets() []*Handler {
+	h.wTargetsLock.Lock()
+	defer h.wTargetsLock.Unlock()
+
+	var targets []*Handler
+	for target := range h.wTargets {
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// writeCtrl writes a control message bypassing filters and ignores errors.
+func (h *Handler) writeCtrl(b []byte) {
+	if h.res.IsWable() {
+		h.send(nil, b)
+	}
+}
+
+// broadcast writes a control message to all write targets.
+func (h *Handler) broadcast(b []byte) {
+	for _, target := range h.getAllWriteTargets() {
+		target.writeCtrl(b)
+	}
+}
+
+// getWriteTargets returns write targets of the handler. Among members of
+// a group, only members selected by the group become write targets.
+func (h *Handler) getWriteTargets() []*Handler {
+	h.wTargetsLock.Lock()
+	direct, groups := h.wDirect, h.wGroups
+	h.wTargetsLock.Unlock()
+
+	targets := make([]*Handler, 0, len(direct)+len(groups))
+	targets = append(targets, direct...)
+	for g, linked := range groups {
+		targets = append(targets, g.Select(h, linked)...)
+	}
+	return targets
+}
+
+// GetPending returns the number of pending writes.
+func (h *Handler) GetPending() int32 {
+	return atomic.LoadInt32(&h.pending)
+}
+
+// isWritable checks the handler could be written to.
+func (h *Handler) isWritable() (bool, error) {
 	h.isRunLock.RLock()
 	defer h.isRunLock.RUnlock()
 
 	if !h.isRun {
-		return 0, ErrNR
+		return false, ErrNR
 	}
 
 	if !h.res.IsWable() {
+		return false, nil
+	}
+
+	// Only the active member of a group is written to
+	if h.group != nil && !h.group.IsActive(h) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Write send data to write goroutine through the white channel.
+func (h *Handler) Write(b []byte) (n int, err error) {
+	return h.WriteFrom(nil, b)
+}
+
+// WriteFrom send data from a source handler to write goroutine through
+// the white channel. The source handler is used to correlate requests.
+func (h *Handler) WriteFrom(src *Handler, b []byte) (n int, err error) {
+	return h.writeFrom(src, nil, b)
+}
+
+// writeFrom writes data from a source handler. buf is the read buffer of
+// data, and the write queue holds a reference of buf instead of a copy.
+func (h *Handler) writeFrom(src *Handler, buf *Buf, b []byte) (n int, err error) {
+	ok, err := h.isWritable()
+	if !ok {
+		return 0, err
+	}
+
+	// Filter data to write
+	b = h.applyWFilter(src, b)
+	if len(b) == 0 {
 		return 0, nil
 	}
 
+	// Transform data to write
+	if h.wTrans != nil {
+		b = h.applyWTransform(src, b)
+		if len(b) == 0 {
+			return 0, nil
+		}
+	}
+
+	// Intercept data to write
+	if len(h.interceptors) > 0 {
+		b, err = h.interceptWrite(src, b)
+		if len(b) == 0 {
+			return 0, err
+		}
+	}
+
+	// Only the lock holder writes
+	if h.lock != nil && src != nil && !h.lock.Check(src, b) {
+		return 0, nil
+	}
+	return h.deliver(src, buf, b)
+}
+
+// deliver writes data from a source handler which passed filters,
+// transforms, interceptors and the lock.
+func (h *Handler) deliver(src *Handler, buf *Buf, b []byte) (n int, err error) {
+	// Register the request before writing
+	if h.corr != nil && src != nil {
+		h.corr.Request(src, b)
+	}
+
+	// Tag the write with the source for echo suppression
+	if h.echo != nil && src != nil {
+		h.echo.Write(src)
+	}
+
+	// Tap data to write
+	for _, t := range h.taps {
+		t.Tap(RecordWrite, h, src, b)
+	}
+
+	n, err = h.send(buf, b)
+	if err != nil && h.corr != nil && src != nil {
+		h.corr.Cancel(src)
+	}
+	return n, err
+}
+
+// write send data to write goroutine and wait the result.
+func (h *Handler) write(b []byte) (n int, err error) {
+	h.isRunLock.RLock()
+	defer h.isRunLock.RUnlock()
+
+	if !h.isRun {
+		return 0, ErrNR
+	}
+
+	atomic.AddInt32(&h.pending, 1)
+	defer atomic.AddInt32(&h.pending, -1)
+
 	h.wChanData <- b
 	result := <-h.wChanResult
 	return (*result).n, *(*result).err
 }
 
+// send writes data through the write queue if the handler has the queue,
+// otherwise it waits the result of the write.
+func (h *Handler) send(buf *Buf, b []byte) (n int, err error) {
+	if h.wQueue == nil {
+		return h.write(b)
+	}
+	return h.enqueue(buf, b)
+}
+
+// enqueue queues data to the write queue without waiting. The queue holds
+// a reference of buf until data is written, and data without buf is
+// copied because the caller could reuse it.
+func (h *Handler) enqueue(buf *Buf, b []byte) (n int, err error) {
+	h.isRunLock.RLock()
+	defer h.isRunLock.RUnlock()
+
+	if !h.isRun {
+		return 0, ErrNR
+	}
+
+	item := wItem{data: b, buf: buf}
+	if buf != nil {
+		buf.Ref()
+	} else {
+		item.data = append([]byte(nil), b...)
+	}
+
+	atomic.AddInt32(&h.pending, 1)
+	select {
+	case h.wQueue <- item:
+		return len(b), nil
+	default:
+	}
+	atomic.AddInt32(&h.pending, -1)
+	item.release()
+
+	// The write queue is full
+	if h.wPolicy == WriteDisconnect {
+		h.logger().Warnf("Res handler - %s - write queue is full - disconnect",
+			*h.res.GetInfo())
+		go h.disconnect()
+		return 0, ErrNR
+	}
+	atomic.AddInt64(&h.drops, 1)
+	h.logger().Warnf("Res handler - %s - write queue is full - drop data - %d",
+		*h.res.GetInfo(), len(b))
+	return 0, nil
+}
+
+// writeRes writes data to the resource in the write goroutine.
+func (h *Handler) writeRes(data []byte) (n int, err error) {
+	// Set the write deadline
+	d, isDeadliner := h.res.(Deadliner)
+	if h.wTimeout > 0 && isDeadliner {
+		d.SetWriteDeadline(time.Now().Add(h.wTimeout))
+	}
+
+	// Write to resource
+	h.wLock.Lock()
+	n, err = h.res.Write(data)
+	h.wLock.Unlock()
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		// Disconnect the resource which misses the deadline
+		h.logger().Warnf("Res handler - %s - write goroutine - "+
+			"write deadline is exceeded", *h.res.GetInfo())
+		go h.disconnect()
+	} else if err != nil {
+		h.logger().WithErr(err).Errorf("Res handler - %s - write goroutine - "+
+			"write to resource error - %s",
+			*h.res.GetInfo(), err.Error())
+	} else if n != len(data) {
+		h.logger().Errorf("Res handler - %s - write goroutine - "+
+			"size of write is diff - request %d - result %d",
+			*h.res.GetInfo(), len(data), n)
+	}
+	return n, err
+}
+
+// release releases the read buffer of the item.
+func (item *wItem) release() {
+	if item.buf != nil {
+		item.buf.Release()
+	}
+}
+
+// drainQueue drops data left in the write queue after the write goroutine
+// is stopped.
+func (h *Handler) drainQueue() {
+	for {
+		select {
+		case item := <-h.wQueue:
+			item.release()
+			atomic.AddInt32(&h.pending, -1)
+		default:
+			return
+		}
+	}
+}
+
+// route routes data read from the resource to write targets.
+// buf is the read buffer of data, and each write target with the write
+// queue holds a reference of buf until data is written.
+func (h *Handler) route(buf *Buf, data []byte) {
+	// Handle control commands in order with data
+	if h.isCtrl {
+		h.routeCtrl(buf, data)
+		return
+	}
+	h.routeData(buf, data)
+}
+
+// routeCtrl handles control command lines in data read from the resource,
+// and routes the rest of data in order. A control command is a line which
+// starts with CtrlPrefix. The trailing partial line which could be
+// a control command is kept until the rest of the line is read.
+func (h *Handler) routeCtrl(buf *Buf, data []byte) {
+	if len(h.ctrlRest) > 0 {
+		data = append(h.ctrlRest, data...)
+		h.ctrlRest = nil
+	}
+
+	start := 0
+	for pos := 0; pos < len(data); {
+		end := len(data)
+		if i := bytes.IndexByte(data[pos:], '\n'); i >= 0 {
+			end = pos + i + 1
+		}
+		line := data[pos:end]
+		isLineStart := !h.ctrlMid
+		h.ctrlMid = line[len(line)-1] != '\n'
+
+		if isLineStart && !h.ctrlMid && isCtrl(line) {
+			h.routeData(buf, data[start:pos])
+			h.handleCtrl(line)
+			start = end
+		} else if isLineStart && h.ctrlMid && mayCtrl(line) {
+			h.routeData(buf, data[start:pos])
+			h.ctrlRest = append([]byte(nil), line...)
+			h.ctrlMid = false
+			start = end
+		}
+		pos = end
+	}
+	h.routeData(buf, data[start:])
+}
+
+// routeData routes data read from the resource to write targets.
+func (h *Handler) routeData(buf *Buf, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	// Drop data from inactive members of a group
+	if h.group != nil && !h.group.IsActive(h) {
+		return
+	}
+
+	// Intercept data before routing
+	if len(h.interceptors) > 0 {
+		var err error
+		data, err = h.interceptRead(data)
+		if err != nil {
+			h.logger().WithErr(err).Warnf("Res handler - %s - read goroutine - "+
+				"drop data by interceptor - %s", *h.res.GetInfo(), err.Error())
+		}
+		if len(data) == 0 {
+			return
+		}
+	}
+
+	// Route a response only to the client which sent the request
+	if h.corr != nil {
+		for _, frame := range h.corr.Response(data) {
+			targets := h.getWriteTargets()
+			if frame.src != nil {
+				targets = []*Handler{frame.src}
+			}
+			h.routeTo(buf, frame.data, targets)
+		}
+		return
+	}
+
+	h.routeTo(buf, data, h.getWriteTargets())
+}
+
+// routeTo routes a frame of data read from the resource to the write
+// targets.
+func (h *Handler) routeTo(buf *Buf, data []byte, targets []*Handler) {
+	// Suppress the echo to the client which wrote the data
+	if h.echo != nil {
+		if src := h.echo.Read(); src != nil {
+			for i, target := range targets {
+				if target == src {
+					targets = append(targets[:i], targets[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	// Filter data to write targets
+	data = h.applyRFilter(data)
+	if len(data) == 0 {
+		return
+	}
+
+	// Transform data to write targets
+	if h.rTrans != nil {
+		data = h.applyRTransform(data)
+		if len(data) == 0 {
+			return
+		}
+	}
+
+	// Write to write targets. Writes to targets with the write queue do
+	// not wait, and writes to other targets run concurrently, so a slow
+	// target does not stall other targets.
+	var waits []*Handler
+	for _, target := range targets {
+		if target.wQueue == nil {
+			waits = append(waits, target)
+			continue
+		}
+		h.writeTarget(target, buf, data)
+	}
+	if len(waits) == 1 {
+		h.writeTarget(waits[0], buf, data)
+		return
+	}
+	wg := &sync.WaitGroup{}
+	for _, target := range waits {
+		wg.Add(1)
+		go func(target *Handler) {
+			defer wg.Done()
+			h.writeTarget(target, buf, data)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// writeTarget writes data read from the resource to a write target.
+func (h *Handler) writeTarget(target *Handler, buf *Buf, data []byte) {
+	_, err := target.writeFrom(h, buf, data)
+	if err != nil {
+		if err == ErrNR {
+			h.logger().Infof("Res handler - %s - write target (%s) is closed",
+				*h.res.GetInfo(), *target.res.GetInfo())
+			h.RemoveWriteTarget(target)
+		} else {
+			h.logger().WithErr(err).Errorf("Res handler - %s - read goroutine - "+
+				"write to write target error - %s",
+				*h.res.GetInfo(), err.Error())
+		}
+	}
+}
+
+// disconnect closes the resource, stops the handler and sends the close
+// event. Only the first disconnect of a resource sends the close event.
+func (h *Handler) disconnect() {
+	if h.res.Close() == ErrALC {
+		return
+	}
+	h.Stop()
+
+	// Send close event. Nobody receives the event after the handler is
+	// closed.
+	if h.closeNoti != nil {
+		select {
+		case h.closeNoti <- h:
+		case <-h.closed:
+		}
+	}
+}
+
 // Run runs handler.
 func (h *Handler) Run() {
-	log.Infof("Run the res handler - %s", *h.res.GetInfo())
+	h.logger().Infof("Run the res handler - %s", *h.res.GetInfo())
 	h.isRunLock.Lock()
-	defer h.isRunLock.Unlock()
-
 	if h.isRun == true {
+		h.isRunLock.Unlock()
 		return
 	}
 	h.isRun = true
 
+	// Write goroutine
+	if h.res.IsWable() {
+		go func() {
+			for {
+				select {
+				case <-h.wQuit:
+					h.logger().Infof("Res handler - %s - write goroutine - close",
+						*h.res.GetInfo())
+					h.drainQueue()
+					return
+
+				case data, ok := <-h.wChanData:
+					// The channel is closed by Close
+					if !ok {
+						h.drainQueue()
+						return
+					}
+					n, err := h.writeRes(data)
+					h.wChanResult <- &WriteResult{n: n, err: &err}
+
+				case item := <-h.wQueue:
+					h.writeRes(item.data)
+					item.release()
+					atomic.AddInt32(&h.pending, -1)
+				}
+			}
+		}()
+	}
+	h.isRunLock.Unlock()
+
+	// Interceptors could write to the handler on open
+	h.interceptOpen()
+
 	// Read goroutine
 	if h.res.IsRable() {
 		go func() {
 			for {
 				select {
 				case <-h.rQuit:
-					log.Infof("Res handler - %s - read goroutine - close",
+					h.logger().Infof("Res handler - %s - read goroutine - close",
 						*h.res.GetInfo())
 					return
 
 				default:
+					// Relay data without copy if possible
+					if h.splice() {
+						continue
+					}
+
 					// Read from resource
-					b := make([]byte, ReadBufSize)
-					n, err := h.res.Read(b)
+					buf := h.bufPool.Get()
+					n, err := h.res.Read(buf.Bytes())
 					if err != nil {
+						buf.Release()
+
 						if err == io.EOF {
 							// Resource (connection) is closed
-							log.Infof("Res handler - %s - resource is closed",
+							h.logger().Infof("Res handler - %s - resource is closed",
 								*h.res.GetInfo())
-							h.res.Close()
-							h.Stop()
-
-							// Send close event
-							if h.closeNoti != nil {
-								h.closeNoti <- h
-							}
+							h.disconnect()
+						} else if !h.res.IsOpen() {
+							// Resource is closed by the handler
+							time.Sleep(10 * time.Millisecond)
 						} else {
 							// Error
-							log.Errorf("Res handler - %s - read goroutine - "+
+							h.logger().WithErr(err).Errorf("Res handler - %s - read goroutine - "+
 								"read from resource error - %s",
 								*h.res.GetInfo(), err.Error())
 						}
 						continue
 					}
 
-					// Write to all write targets
-					for target := range h.wTargets {
-						_, err := target.Write(b[:n])
-						if err != nil {
-							if err == ErrNR {
-								log.Infof("Res handler - %s - write target (%s) is closed",
-									*h.res.GetInfo(), *target.res.GetInfo())
-								h.RemoveWriteTarget(target)
-							} else {
-								log.Errorf("Res handler - %s - read goroutine - "+
-									"write to write target error - %s",
-									*h.res.GetInfo(), err.Error())
-							}
-						}
+					// Tap data read from resource
+					for _, t := range h.taps {
+						t.Tap(RecordRead, h, nil, buf.Bytes()[:n])
 					}
-				}
-			}
-		}()
-	}
-
-	// Write goroutine
-	if h.res.IsWable() {
-		go func() {
-			for {
-				select {
-				case <-h.wQuit:
-					log.Infof("Res handler - %s - write goroutine - close",
-						*h.res.GetInfo())
-					return
 
-				case data := <-h.wChanData:
-					// Write to resource
-					n, err := h.res.Write(data)
-					if err != nil {
-						log.Errorf("Res handler - %s - write goroutine - "+
-							"write to resource error - %s",
-							*h.res.GetInfo(), err.Error())
-					} else if n != len(data) {
-						log.Errorf("Res handler - %s - write goroutine - "+
-							"size of write is diff - request %d - result %d",
-							*h.res.GetInfo(), len(data), n)
+					// Limit rate of data read from resource
+					if h.limiter != nil && !h.limiter.Take(n) {
+						h.logger().Debugf("Res handler - %s - read goroutine - "+
+							"drop data by rate limit - %d", *h.res.GetInfo(), n)
+						buf.Release()
+						continue
 					}
 
-					h.wChanResult <- &WriteResult{n: n, err: &err}
+					h.route(buf, buf.Bytes()[:n])
+					buf.Release()
 				}
 			}
 		}()
 	}
 }
 
+// quit sends quit signals to running goroutines. Goroutines which are not
+// run by the resource mode are not signaled, otherwise the signal remains
+// and blocks the next quit.
+func (h *Handler) quit() {
+	if h.res.IsRable() {
+		h.rQuit <- struct{}{}
+	}
+	if h.res.IsWable() {
+		h.wQuit <- struct{}{}
+	}
+}
+
 // Stop stops the handler.
 func (h *Handler) Stop() {
-	log.Infof("Stop the res handler - %s", *h.res.GetInfo())
+	h.logger().Infof("Stop the res handler - %s", *h.res.GetInfo())
 	h.isRunLock.Lock()
-	defer h.isRunLock.Unlock()
-
 	if h.isRun == false {
+		h.isRunLock.Unlock()
 		return
 	}
 
-	h.rQuit <- struct{}{}
-	h.wQuit <- struct{}{}
+	h.quit()
 	h.isRun = false
+	h.isRunLock.Unlock()
+
+	h.interceptClose()
 }
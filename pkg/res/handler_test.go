@@ -0,0 +1,232 @@
+package res
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockRes is a write only resource which blocks writes until it is
+// unblocked or closed.
+type blockRes struct {
+	info    string
+	unblock chan struct{}
+	closed  chan struct{}
+
+	lock    *sync.Mutex
+	isOpen  bool
+	written []byte
+}
+
+// newBlockRes allocates a blocked resource.
+func newBlockRes(info string) *blockRes {
+	return &blockRes{
+		info:    info,
+		unblock: make(chan struct{}),
+		closed:  make(chan struct{}),
+		lock:    &sync.Mutex{},
+		isOpen:  true,
+	}
+}
+
+func (res *blockRes) GetInfo() *string { return &res.info }
+func (res *blockRes) Open() error      { return nil }
+func (res *blockRes) IsRable() bool    { return false }
+func (res *blockRes) IsWable() bool    { return true }
+
+func (res *blockRes) Close() error {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	if !res.isOpen {
+		return ErrALC
+	}
+	res.isOpen = false
+	close(res.closed)
+	return nil
+}
+
+func (res *blockRes) IsOpen() bool {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	return res.isOpen
+}
+
+func (res *blockRes) Read(b []byte) (n int, err error) {
+	<-res.closed
+	return 0, io.EOF
+}
+
+func (res *blockRes) Write(b []byte) (n int, err error) {
+	select {
+	case <-res.unblock:
+	case <-res.closed:
+		return 0, io.ErrClosedPipe
+	}
+
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	res.written = append(res.written, b...)
+	return len(b), nil
+}
+
+// getWritten returns data written to the resource.
+func (res *blockRes) getWritten() string {
+	res.lock.Lock()
+	defer res.lock.Unlock()
+
+	return string(res.written)
+}
+
+// TestWriteQueue checks a blocked client with the write queue does not
+// stall other clients, and data over the queue is dropped or the client
+// is disconnected by the policy.
+func TestWriteQueue(t *testing.T) {
+	const lines = 10
+
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{name: "drop", policy: WriteDrop},
+		{name: "disconnect", policy: WriteDisconnect},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, srvPeer := newTestMemRW(t, testName(t, "srv"))
+			fast, fastPeer := newTestMemRW(t, testName(t, "fast"))
+
+			slowRes := newBlockRes(testName(t, "slow"))
+			slow := NewHandler(slowRes, nil)
+			if err := slow.SetWriteQueue(2, &test.policy); err != nil {
+				t.Fatalf("SetWriteQueue() error - %v", err)
+			}
+			slow.Run()
+			t.Cleanup(func() {
+				slow.Stop()
+				slowRes.Close()
+			})
+
+			link(srv, fast)
+			link(srv, slow)
+
+			var want string
+			for i := 0; i < lines; i++ {
+				line := strconv.Itoa(i) + "\n"
+				srvPeer.write(t, line)
+				fastPeer.expect(t, line)
+				want += line
+			}
+
+			// Wait until all lines are routed to the blocked client
+			deadline := time.Now().Add(testTimeout)
+			for slow.GetDrops()+int64(slow.GetPending()) < lines && slowRes.IsOpen() &&
+				time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			switch test.policy {
+			case WriteDrop:
+				drops := slow.GetDrops()
+				if drops < lines-3 || drops > lines-2 {
+					t.Errorf("GetDrops() is %d, want %d or %d", drops, lines-3, lines-2)
+				}
+
+				// Queued data is written after the client is unblocked
+				close(slowRes.unblock)
+				deadline = time.Now().Add(testTimeout)
+				for slow.GetPending() > 0 && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+				got := slowRes.getWritten()
+				if int64(len(got)/2)+drops != lines || got != want[:len(got)] {
+					t.Errorf("Written %q with %d drops, want the head of %q", got, drops, want)
+				}
+
+			case WriteDisconnect:
+				for slowRes.IsOpen() && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+				if slowRes.IsOpen() {
+					t.Errorf("Blocked client is not disconnected")
+				}
+				if drops := slow.GetDrops(); drops != 0 {
+					t.Errorf("GetDrops() is %d, want 0", drops)
+				}
+			}
+		})
+	}
+}
+
+// TestFanOut checks a blocked client without the write queue does not
+// stall writes to other clients without the write queue.
+func TestFanOut(t *testing.T) {
+	srv, srvPeer := newTestMemRW(t, testName(t, "srv"))
+
+	var blocks []*blockRes
+	var clients []*Handler
+	for _, m := range []string{"a", "b"} {
+		r := newBlockRes(testName(t, m))
+		h := NewHandler(r, nil)
+		h.Run()
+		t.Cleanup(func() {
+			h.Stop()
+			r.Close()
+		})
+		link(srv, h)
+		blocks = append(blocks, r)
+		clients = append(clients, h)
+	}
+
+	// Both clients are written while they are blocked
+	srvPeer.write(t, "a\n")
+	deadline := time.Now().Add(testTimeout)
+	for clients[0].GetPending() != 1 || clients[1].GetPending() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("GetPending() of clients are %d and %d, want 1", clients[0].GetPending(),
+				clients[1].GetPending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, r := range blocks {
+		close(r.unblock)
+	}
+	for _, h := range clients {
+		for h.GetPending() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	for i, r := range blocks {
+		if got := r.getWritten(); got != "a\n" {
+			t.Errorf("Written to client %d is %q, want %q", i, got, "a\n")
+		}
+	}
+}
+
+// TestSetWriteQueue checks wrong write queue options.
+func TestSetWriteQueue(t *testing.T) {
+	tests := []struct {
+		size   int
+		policy string
+		err    error
+	}{
+		{size: 1, policy: WriteDrop},
+		{size: WriteQueueSize, policy: WriteDisconnect},
+		{size: 0, policy: WriteDrop, err: ErrWQueue},
+		{size: 1, policy: "BLOCK", err: ErrWQueue},
+	}
+
+	for _, test := range tests {
+		h := NewHandler(newBlockRes("block"), nil)
+		if err := h.SetWriteQueue(test.size, &test.policy); err != test.err {
+			t.Errorf("SetWriteQueue(%d, %s) error - %v, want %v", test.size, test.policy,
+				err, test.err)
+		}
+	}
+}
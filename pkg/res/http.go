@@ -0,0 +1,201 @@
+package res
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// HTTP client kinds.
+const (
+	HTTPStream = "STREAM"
+	HTTPWrite  = "WRITE"
+)
+
+// Targeter is implemented by client resources which are bound to
+// a specific server resource instead of all server resources.
+type Targeter interface {
+	GetTarget() *string
+}
+
+// HTTP represents a HTTP request from a client. A stream HTTP resource
+// writes the broadcast to the response, and a write HTTP resource
+// reads the request body.
+type HTTP struct {
+	w       http.ResponseWriter
+	req     *http.Request
+	flusher http.Flusher
+	done    chan struct{}
+
+	kind   string
+	target *string
+	isSSE  bool
+
+	isOpenLock *sync.Mutex
+	isOpen     bool
+}
+
+// NewHTTPStream allocates and initializes a stream HTTP instance.
+// If target is nil, the stream receives data from all server resources.
+func NewHTTPStream(w http.ResponseWriter, req *http.Request, target *string,
+	isSSE bool) (*HTTP, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("Do not support flush")
+	}
+
+	return &HTTP{
+		w:       w,
+		req:     req,
+		flusher: flusher,
+		done:    make(chan struct{}),
+
+		kind:   HTTPStream,
+		target: target,
+		isSSE:  isSSE,
+
+		isOpenLock: &sync.Mutex{},
+		isOpen:     true,
+	}, nil
+}
+
+// NewHTTPWrite allocates and initializes a write HTTP instance.
+// If target is nil, the body is written to all server resources.
+func NewHTTPWrite(w http.ResponseWriter, req *http.Request, target *string) *HTTP {
+	return &HTTP{
+		w:       w,
+		req:     req,
+		flusher: nil,
+		done:    make(chan struct{}),
+
+		kind:   HTTPWrite,
+		target: target,
+		isSSE:  false,
+
+		isOpenLock: &sync.Mutex{},
+		isOpen:     true,
+	}
+}
+
+// Open opens the resource. Do not use this
+func (res *HTTP) Open() error {
+	return errors.New("Do not support Open()")
+}
+
+// Close closes the HTTP resource. After Close, the response is not
+// touched anymore.
+func (res *HTTP) Close() error {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == false {
+		return ErrALC
+	}
+
+	res.isOpen = false
+	close(res.done)
+	return nil
+}
+
+// Done returns a channel which is closed when the resource is closed.
+func (res *HTTP) Done() <-chan struct{} {
+	return res.done
+}
+
+// GetInfo get HTTP resource's info.
+func (res *HTTP) GetInfo() *string {
+	tmp := fmt.Sprintf("%s:%s:%s", TypeHTTP, res.kind, res.req.RemoteAddr)
+	return &tmp
+}
+
+// GetHost get the host of the HTTP client without the port.
+func (res *HTTP) GetHost() string {
+	host, _, err := net.SplitHostPort(res.req.RemoteAddr)
+	if err != nil {
+		return res.req.RemoteAddr
+	}
+	return host
+}
+
+// GetTarget get the server resource info which the HTTP resource is bound to.
+func (res *HTTP) GetTarget() *string {
+	return res.target
+}
+
+// Read blocks until the request is finished for a stream HTTP resource,
+// and reads the request body for a write HTTP resource.
+func (res *HTTP) Read(b []byte) (n int, err error) {
+	if res.kind == HTTPStream {
+		select {
+		case <-res.req.Context().Done():
+		case <-res.done:
+		}
+		return 0, io.EOF
+	}
+
+	// A broken body also finishes the request
+	n, err = res.req.Body.Read(b)
+	if err != nil {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes data to the response as SSE events or a chunk.
+func (res *HTTP) Write(b []byte) (n int, err error) {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == false {
+		return 0, ErrALC
+	}
+
+	if res.isSSE {
+		var buf bytes.Buffer
+		for _, line := range bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n")) {
+			buf.WriteString("data: ")
+			buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+
+		_, err = res.w.Write(buf.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		res.flusher.Flush()
+		return len(b), nil
+	}
+
+	n, err = res.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	res.flusher.Flush()
+	return n, nil
+}
+
+// IsOpen checks open of the resource.
+func (res *HTTP) IsOpen() bool {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	return res.isOpen
+}
+
+// IsRable checks resource is readable.
+func (res *HTTP) IsRable() bool {
+	return true
+}
+
+// IsWable check resource is writeable
+func (res *HTTP) IsWable() bool {
+	return res.kind == HTTPStream
+}
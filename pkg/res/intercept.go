@@ -0,0 +1,99 @@
+package res
+
+// Interceptor defines the interface to inspect and modify data of a
+// handler in process. OnRead is called with data read from the resource
+// before routing, and OnWrite is called for each write target with data
+// written to the resource from src, which is nil for writes not from a
+// handler. Returned data replaces the data, and empty data or an error
+// drops the data. Data must not be retained after the call because read
+// buffers are reused. OnOpen is called when the handler runs, and OnClose
+// is called when the handler stops.
+type Interceptor interface {
+	OnRead(h *Handler, b []byte) ([]byte, error)
+	OnWrite(h *Handler, src *Handler, b []byte) ([]byte, error)
+	OnOpen(h *Handler)
+	OnClose(h *Handler)
+}
+
+// InterceptorFuncs is an interceptor of optional functions. Nil functions
+// pass data through.
+type InterceptorFuncs struct {
+	Read  func(h *Handler, b []byte) ([]byte, error)
+	Write func(h *Handler, src *Handler, b []byte) ([]byte, error)
+	Open  func(h *Handler)
+	Close func(h *Handler)
+}
+
+// OnRead calls the Read function.
+func (i *InterceptorFuncs) OnRead(h *Handler, b []byte) ([]byte, error) {
+	if i.Read == nil {
+		return b, nil
+	}
+	return i.Read(h, b)
+}
+
+// OnWrite calls the Write function.
+func (i *InterceptorFuncs) OnWrite(h *Handler, src *Handler, b []byte) ([]byte, error) {
+	if i.Write == nil {
+		return b, nil
+	}
+	return i.Write(h, src, b)
+}
+
+// OnOpen calls the Open function.
+func (i *InterceptorFuncs) OnOpen(h *Handler) {
+	if i.Open != nil {
+		i.Open(h)
+	}
+}
+
+// OnClose calls the Close function.
+func (i *InterceptorFuncs) OnClose(h *Handler) {
+	if i.Close != nil {
+		i.Close(h)
+	}
+}
+
+// AddInterceptor appends an interceptor of the handler. Interceptors are
+// called in order of addition, and they must be added before Run.
+func (h *Handler) AddInterceptor(i Interceptor) {
+	h.interceptors = append(h.interceptors, i)
+}
+
+// interceptRead passes data read from the resource through interceptors.
+func (h *Handler) interceptRead(b []byte) ([]byte, error) {
+	var err error
+	for _, i := range h.interceptors {
+		b, err = i.OnRead(h, b)
+		if err != nil || len(b) == 0 {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// interceptWrite passes data written to the resource through interceptors.
+func (h *Handler) interceptWrite(src *Handler, b []byte) ([]byte, error) {
+	var err error
+	for _, i := range h.interceptors {
+		b, err = i.OnWrite(h, src, b)
+		if err != nil || len(b) == 0 {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// interceptOpen notifies interceptors that the handler runs.
+func (h *Handler) interceptOpen() {
+	for _, i := range h.interceptors {
+		i.OnOpen(h)
+	}
+}
+
+// interceptClose notifies interceptors that the handler stops.
+func (h *Handler) interceptClose() {
+	for _, i := range h.interceptors {
+		i.OnClose(h)
+	}
+}
@@ -0,0 +1,107 @@
+package res
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// suffixInterceptor returns an interceptor which appends the suffix to
+// data. Data of the drop suffix is dropped with the error.
+func suffixInterceptor(suffix string, drop string, err error) *InterceptorFuncs {
+	f := func(b []byte) ([]byte, error) {
+		if drop != "" && string(b) == drop {
+			return nil, err
+		}
+		return append(append([]byte(nil), b...), suffix...), nil
+	}
+	return &InterceptorFuncs{
+		Read: func(h *Handler, b []byte) ([]byte, error) {
+			return f(b)
+		},
+		Write: func(h *Handler, src *Handler, b []byte) ([]byte, error) {
+			return f(b)
+		},
+	}
+}
+
+// TestInterceptor checks interceptors are called in order of addition on
+// reads and writes, and empty data or an error drops data.
+func TestInterceptor(t *testing.T) {
+	errDrop := errors.New("drop")
+
+	tests := []struct {
+		name  string
+		write bool
+		data  string
+		want  string
+	}{
+		{name: "read", data: "a", want: "a12"},
+		{name: "read-empty", data: "x", want: ""},
+		{name: "read-error", data: "y", want: ""},
+		{name: "write", write: true, data: "a", want: "a12"},
+		{name: "write-empty", write: true, data: "x", want: ""},
+		{name: "write-error", write: true, data: "y", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sResH, sPeer := newTestMem(t, testName(t, "server"), (1<<ModeR)|(1<<ModeW))
+			cResH, cPeer := newTestMemRW(t, testName(t, "client"))
+
+			// The first interceptor drops x, and the second drops y
+			h := sResH
+			if test.write {
+				h = cResH
+			}
+			h.AddInterceptor(suffixInterceptor("1", "x", nil))
+			h.AddInterceptor(suffixInterceptor("2", "y1", errDrop))
+			h.AddInterceptor(&InterceptorFuncs{})
+			sResH.Run()
+			link(sResH, cResH)
+
+			sPeer.write(t, test.data)
+			if test.want == "" {
+				cPeer.expectNone(t, 100*time.Millisecond)
+				return
+			}
+			cPeer.expect(t, test.want)
+		})
+	}
+}
+
+// TestInterceptorOpenClose checks OnOpen and OnClose are called when the
+// handler runs and stops.
+func TestInterceptorOpenClose(t *testing.T) {
+	h, _ := newTestMem(t, testName(t, "res"), (1<<ModeR)|(1<<ModeW))
+
+	var opens, closes int32
+	h.AddInterceptor(&InterceptorFuncs{
+		Open:  func(h *Handler) { atomic.AddInt32(&opens, 1) },
+		Close: func(h *Handler) { atomic.AddInt32(&closes, 1) },
+	})
+
+	steps := []struct {
+		f      func()
+		opens  int32
+		closes int32
+	}{
+		{f: h.Run, opens: 1, closes: 0},
+		{f: h.Run, opens: 1, closes: 0},
+		{f: h.Stop, opens: 1, closes: 1},
+		{f: h.Run, opens: 2, closes: 1},
+		{f: h.Close, opens: 2, closes: 2},
+		{f: h.Stop, opens: 2, closes: 2},
+	}
+
+	for i, step := range steps {
+		step.f()
+		if got := atomic.LoadInt32(&opens); got != step.opens {
+			t.Errorf("Step %d: OnOpen is called %d times, want %d", i, got, step.opens)
+		}
+		if got := atomic.LoadInt32(&closes); got != step.closes {
+			t.Errorf("Step %d: OnClose is called %d times, want %d", i, got, step.closes)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package res
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit modes.
+const (
+	LimitDelay = "DELAY"
+	LimitDrop  = "DROP"
+)
+
+// ErrLimit is error instance for wrong rate limit option.
+var ErrLimit = errors.New("Wrong rate limit option")
+
+// bucket represents a token bucket. The burst of a bucket is tokens
+// of one second.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket allocates and initializes a full bucket instance.
+func newBucket(rate float64) *bucket {
+	return &bucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// refill fills tokens by the elapsed time.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Limiter limits bytes/sec and frames/sec of data by token buckets.
+// In delay mode, data takes tokens even if tokens are not enough, and
+// waits until the debt is paid off. In drop mode, data without enough
+// tokens is dropped, so a frame larger than the burst is always dropped.
+type Limiter struct {
+	mode string
+
+	lock   *sync.Mutex
+	bytes  *bucket
+	frames *bucket
+}
+
+// NewLimiter allocates and initializes a limiter instance.
+// A rate less than or equal to 0 means no limit.
+func NewLimiter(mode *string, bytesRate float64, framesRate float64) (*Limiter, error) {
+	switch *mode {
+	case LimitDelay, LimitDrop:
+	default:
+		return nil, ErrLimit
+	}
+
+	if bytesRate <= 0 && framesRate <= 0 {
+		return nil, ErrLimit
+	}
+
+	l := &Limiter{
+		mode: *mode,
+		lock: &sync.Mutex{},
+	}
+	if bytesRate > 0 {
+		l.bytes = newBucket(bytesRate)
+	}
+	if framesRate > 0 {
+		l.frames = newBucket(framesRate)
+	}
+	return l, nil
+}
+
+// Take takes tokens for a frame of n bytes. It returns false if the frame
+// should be dropped. In delay mode, it blocks until tokens are filled.
+func (l *Limiter) Take(n int) bool {
+	l.lock.Lock()
+
+	now := time.Now()
+	var wait float64
+	for _, b := range []*bucket{l.bytes, l.frames} {
+		if b == nil {
+			continue
+		}
+		b.refill(now)
+	}
+
+	// Check tokens in drop mode
+	if l.mode == LimitDrop {
+		if (l.bytes != nil && l.bytes.tokens < float64(n)) ||
+			(l.frames != nil && l.frames.tokens < 1) {
+			l.lock.Unlock()
+			return false
+		}
+	}
+
+	// Take tokens, and tokens could be negative in delay mode
+	if l.bytes != nil {
+		l.bytes.tokens -= float64(n)
+		wait = math.Max(wait, -l.bytes.tokens/l.bytes.rate)
+	}
+	if l.frames != nil {
+		l.frames.tokens--
+		wait = math.Max(wait, -l.frames.tokens/l.frames.rate)
+	}
+	l.lock.Unlock()
+
+	if wait > 0 {
+		time.Sleep(time.Duration(wait * float64(time.Second)))
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package res
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestLimiterTake checks frames which are passed, dropped or delayed by
+// rate limits.
+func TestLimiterTake(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		bytesRate  float64
+		framesRate float64
+		frames     []int
+		want       []bool
+		minElapsed time.Duration
+		maxElapsed time.Duration
+	}{
+		{
+			name:       "drop by frames",
+			mode:       LimitDrop,
+			framesRate: 2,
+			frames:     []int{1, 1, 1},
+			want:       []bool{true, true, false},
+			maxElapsed: 50 * time.Millisecond,
+		},
+		{
+			name:       "drop by bytes",
+			mode:       LimitDrop,
+			bytesRate:  10,
+			frames:     []int{6, 4, 1},
+			want:       []bool{true, true, false},
+			maxElapsed: 50 * time.Millisecond,
+		},
+		{
+			name:       "drop frame larger than burst",
+			mode:       LimitDrop,
+			bytesRate:  10,
+			frames:     []int{20, 10, 1},
+			want:       []bool{false, true, false},
+			maxElapsed: 50 * time.Millisecond,
+		},
+		{
+			name:       "drop by both",
+			mode:       LimitDrop,
+			bytesRate:  100,
+			framesRate: 1,
+			frames:     []int{1, 1},
+			want:       []bool{true, false},
+			maxElapsed: 50 * time.Millisecond,
+		},
+		{
+			name:       "delay by frames",
+			mode:       LimitDelay,
+			framesRate: 4,
+			frames:     []int{1, 1, 1, 1, 1},
+			want:       []bool{true, true, true, true, true},
+			minElapsed: 240 * time.Millisecond,
+			maxElapsed: time.Second,
+		},
+		{
+			name:       "delay by bytes",
+			mode:       LimitDelay,
+			bytesRate:  100,
+			frames:     []int{100, 10, 10},
+			want:       []bool{true, true, true},
+			minElapsed: 190 * time.Millisecond,
+			maxElapsed: time.Second,
+		},
+		{
+			name:       "delay frame larger than burst",
+			mode:       LimitDelay,
+			bytesRate:  100,
+			frames:     []int{150, 10},
+			want:       []bool{true, true},
+			minElapsed: 590 * time.Millisecond,
+			maxElapsed: 1500 * time.Millisecond,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := NewLimiter(&test.mode, test.bytesRate, test.framesRate)
+			if err != nil {
+				t.Fatalf("NewLimiter() error - %v", err)
+			}
+
+			start := time.Now()
+			var got []bool
+			for _, n := range test.frames {
+				got = append(got, l.Take(n))
+			}
+			elapsed := time.Since(start)
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Take() is %v, want %v", got, test.want)
+			}
+			if elapsed < test.minElapsed || elapsed > test.maxElapsed {
+				t.Errorf("Elapsed %v, want between %v and %v", elapsed,
+					test.minElapsed, test.maxElapsed)
+			}
+		})
+	}
+}
+
+// TestNewLimiter checks wrong rate limit options.
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		mode       string
+		bytesRate  float64
+		framesRate float64
+		err        error
+	}{
+		{mode: LimitDelay, bytesRate: 1},
+		{mode: LimitDrop, framesRate: 1},
+		{mode: "WAIT", bytesRate: 1, err: ErrLimit},
+		{mode: LimitDrop, err: ErrLimit},
+		{mode: LimitDelay, bytesRate: -1, framesRate: 0, err: ErrLimit},
+	}
+
+	for _, test := range tests {
+		if _, err := NewLimiter(&test.mode, test.bytesRate, test.framesRate); err != test.err {
+			t.Errorf("NewLimiter(%s, %v, %v) error - %v, want %v", test.mode,
+				test.bytesRate, test.framesRate, err, test.err)
+		}
+	}
+}
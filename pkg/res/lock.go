@@ -0,0 +1,250 @@
+package res
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Lock modes and policies.
+const (
+	LockExplicit = "EXPLICIT"
+	LockImplicit = "IMPLICIT"
+
+	LockReject = "REJECT"
+	LockQueue  = "QUEUE"
+)
+
+// lockWaitInterval is the interval to check a waiting client is still
+// running in queue policy.
+const lockWaitInterval = 100 * time.Millisecond
+
+// LockMaxQueue is the max number of writes queued for each client in
+// explicit mode and queue policy.
+const LockMaxQueue = 256
+
+// ErrLock is error instance for wrong lock option.
+var ErrLock = errors.New("Wrong lock option")
+
+// Lock arbitrates writes of clients to a server resource. Only the client
+// holding the lock may write. The lock is acquired by a control command
+// in explicit mode, or also on the first write in implicit mode, and
+// released after the idle timeout. In queue policy, acquiring waits until
+// the lock is released instead of failing. In explicit mode and queue
+// policy, writes of a client without the lock are queued until the client
+// acquires the lock.
+type Lock struct {
+	owner  *Handler
+	mode   string
+	policy string
+	idle   time.Duration
+
+	lock       *sync.Mutex
+	notifyLock *sync.Mutex
+	holder     *Handler
+	timer      *time.Timer
+	released   chan struct{}
+	queues     map[*Handler][][]byte
+}
+
+// NewLock allocates and initializes a lock instance.
+// If idle is 0, the lock is not released by idle timeout.
+func NewLock(mode *string, policy *string, idle time.Duration) (*Lock, error) {
+	switch *mode {
+	case LockExplicit, LockImplicit:
+	default:
+		return nil, ErrLock
+	}
+
+	switch *policy {
+	case LockReject, LockQueue:
+	default:
+		return nil, ErrLock
+	}
+
+	if idle < 0 {
+		return nil, ErrLock
+	}
+
+	return &Lock{
+		owner:  nil,
+		mode:   *mode,
+		policy: *policy,
+		idle:   idle,
+
+		lock:       &sync.Mutex{},
+		notifyLock: &sync.Mutex{},
+		holder:     nil,
+		timer:      nil,
+		released:   make(chan struct{}),
+		queues:     make(map[*Handler][][]byte),
+	}, nil
+}
+
+// getHolderInfo returns info of the holder.
+func getHolderInfo(holder *Handler) string {
+	if holder == nil {
+		return "none"
+	}
+	return *holder.GetRes().GetInfo()
+}
+
+// unlockNotify unlocks l.lock and notifies the holder change. notifyLock
+// is locked before l.lock is unlocked, so notifications are in the order
+// of changes.
+func (l *Lock) unlockNotify(holder *Handler) {
+	l.notifyLock.Lock()
+	l.lock.Unlock()
+	defer l.notifyLock.Unlock()
+
+	l.notify(holder)
+}
+
+// notify notifies the holder change to all clients.
+func (l *Lock) notify(holder *Handler) {
+	l.owner.logger().Infof("Lock holder is changed - %s - %s", *l.owner.GetRes().GetInfo(),
+		getHolderInfo(holder))
+	l.owner.broadcast(ctrlMsg("%s %s holder %s", CtrlLock,
+		*l.owner.GetRes().GetInfo(), getHolderInfo(holder)))
+}
+
+// setHolder sets the holder and restarts the idle timer.
+// l.lock must be held.
+func (l *Lock) setHolder(holder *Handler) {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if holder == nil && l.holder != nil {
+		close(l.released)
+		l.released = make(chan struct{})
+	}
+	l.holder = holder
+
+	if holder != nil && l.idle > 0 {
+		l.timer = time.AfterFunc(l.idle, func() {
+			l.Release(holder)
+		})
+	}
+}
+
+// tryAcquire acquires the lock if the lock is free or held by src.
+// l.lock must be held.
+func (l *Lock) tryAcquire(src *Handler) (acquired bool, changed bool) {
+	// A holder which is not running anymore releases the lock
+	if l.holder != nil && l.holder != src && !l.holder.isRunning() {
+		l.setHolder(nil)
+	}
+
+	if l.holder == nil {
+		l.setHolder(src)
+		return true, true
+	}
+	if l.holder == src {
+		l.setHolder(src)
+		return true, false
+	}
+	return false, false
+}
+
+// acquire acquires the lock. In queue policy, it blocks until the lock is
+// acquired or src is stopped. Writes queued by src are written after the
+// lock is acquired.
+func (l *Lock) acquire(src *Handler) bool {
+	for {
+		l.lock.Lock()
+		acquired, changed := l.tryAcquire(src)
+		released := l.released
+		var queue [][]byte
+		if acquired {
+			queue = l.queues[src]
+			delete(l.queues, src)
+		}
+		if changed {
+			l.unlockNotify(l.holder)
+		} else {
+			l.lock.Unlock()
+		}
+		if acquired {
+			for _, b := range queue {
+				l.owner.deliver(src, nil, b)
+			}
+			return true
+		}
+		if l.policy == LockReject || !src.isRunning() {
+			return false
+		}
+
+		// Wait until the lock is released. The holder could be stopped
+		// without releasing, so check again at the interval.
+		select {
+		case <-released:
+		case <-time.After(lockWaitInterval):
+		}
+	}
+}
+
+// Acquire acquires the lock explicitly.
+func (l *Lock) Acquire(src *Handler) bool {
+	return l.acquire(src)
+}
+
+// Release releases the lock if src holds the lock. Writes queued by src
+// are dropped.
+func (l *Lock) Release(src *Handler) {
+	l.lock.Lock()
+	delete(l.queues, src)
+	if l.holder != src {
+		l.lock.Unlock()
+		return
+	}
+	l.setHolder(nil)
+	l.unlockNotify(nil)
+}
+
+// GetHolder returns the holder of the lock.
+func (l *Lock) GetHolder() *Handler {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.holder
+}
+
+// queue queues a write of src until src acquires the lock. l.lock must be
+// held.
+func (l *Lock) queue(src *Handler, b []byte) {
+	queue := l.queues[src]
+	if len(queue) >= LockMaxQueue {
+		src.logger().Warnf("Lock queue is full - drop data - %s - %d",
+			*l.owner.GetRes().GetInfo(), len(b))
+		return
+	}
+	l.queues[src] = append(queue, append([]byte(nil), b...))
+}
+
+// Check checks src could write b. In implicit mode, src acquires the lock
+// on the write, and in queue policy, it blocks until the lock is acquired.
+// In explicit mode, only the holder writes, and in queue policy, writes of
+// other clients are queued.
+func (l *Lock) Check(src *Handler, b []byte) bool {
+	l.lock.Lock()
+	if l.holder == src {
+		l.setHolder(src)
+		l.lock.Unlock()
+		return true
+	}
+	if l.mode == LockExplicit && l.policy == LockQueue {
+		l.queue(src, b)
+		l.lock.Unlock()
+		return false
+	}
+	l.lock.Unlock()
+
+	if l.mode == LockImplicit && l.acquire(src) {
+		return true
+	}
+
+	src.writeCtrl(ctrlMsg("%s %s rejected %s", CtrlLock,
+		*l.owner.GetRes().GetInfo(), getHolderInfo(l.GetHolder())))
+	return false
+}
@@ -0,0 +1,153 @@
+package res
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLock checks writes of clients and control messages to clients by
+// the modes and policies of a lock.
+func TestLock(t *testing.T) {
+	type step struct {
+		client int
+		data   string
+		srv    string           // data written to the server, "" means none
+		msgs   map[int][]string // control messages to clients after the lock info
+	}
+
+	tests := []struct {
+		name   string
+		mode   string
+		policy string
+		steps  []step
+	}{
+		{
+			name:   "implicit reject",
+			mode:   LockImplicit,
+			policy: LockReject,
+			steps: []step{
+				{client: 0, data: "a1\n", srv: "a1\n", msgs: map[int][]string{
+					0: {"holder 0"}, 1: {"holder 0"}}},
+				{client: 1, data: "b1\n", msgs: map[int][]string{1: {"rejected 0"}}},
+				{client: 1, data: "#!sbps unlock\n"},
+				{client: 1, data: "b2\n", msgs: map[int][]string{1: {"rejected 0"}}},
+				{client: 0, data: "#!sbps unlock\n", msgs: map[int][]string{
+					0: {"holder none"}, 1: {"holder none"}}},
+				{client: 1, data: "b3\n", srv: "b3\n", msgs: map[int][]string{
+					0: {"holder 1"}, 1: {"holder 1"}}},
+			},
+		},
+		{
+			name:   "implicit queue",
+			mode:   LockImplicit,
+			policy: LockQueue,
+			steps: []step{
+				{client: 0, data: "#!sbps lock\n", msgs: map[int][]string{
+					0: {"holder 0"}, 1: {"holder 0"}}},
+				{client: 1, data: "b1\n"},
+				{client: 0, data: "#!sbps unlock\n", srv: "b1\n", msgs: map[int][]string{
+					0: {"holder none", "holder 1"}, 1: {"holder none", "holder 1"}}},
+				{client: 0, data: "a1\n"},
+			},
+		},
+		{
+			name:   "explicit reject",
+			mode:   LockExplicit,
+			policy: LockReject,
+			steps: []step{
+				// A write does not acquire the lock
+				{client: 0, data: "a1\n", msgs: map[int][]string{0: {"rejected none"}}},
+				{client: 0, data: "#!sbps lock\n", msgs: map[int][]string{
+					0: {"holder 0"}, 1: {"holder 0"}}},
+				{client: 0, data: "a2\n", srv: "a2\n"},
+				{client: 1, data: "#!sbps lock\n", msgs: map[int][]string{1: {"busy 0"}}},
+				{client: 1, data: "b1\n", msgs: map[int][]string{1: {"rejected 0"}}},
+			},
+		},
+		{
+			name:   "explicit queue",
+			mode:   LockExplicit,
+			policy: LockQueue,
+			steps: []step{
+				{client: 0, data: "#!sbps lock\n", msgs: map[int][]string{
+					0: {"holder 0"}, 1: {"holder 0"}}},
+				// Writes of a client without the lock are queued until the
+				// client acquires the lock
+				{client: 1, data: "b1\n"},
+				{client: 1, data: "b2\n#!sbps lock\n"},
+				{client: 0, data: "#!sbps unlock\n", srv: "b1\nb2\n", msgs: map[int][]string{
+					0: {"holder none", "holder 1"}, 1: {"holder none", "holder 1"}}},
+				{client: 1, data: "b3\n", srv: "b3\n"},
+				// Queued writes are dropped by unlock
+				{client: 0, data: "a1\n"},
+				{client: 0, data: "#!sbps unlock\n"},
+				{client: 1, data: "#!sbps unlock\n", msgs: map[int][]string{
+					0: {"holder none"}, 1: {"holder none"}}},
+				{client: 0, data: "#!sbps lock\n", msgs: map[int][]string{
+					0: {"holder 0"}, 1: {"holder 0"}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := NewLock(&test.mode, &test.policy, 0)
+			if err != nil {
+				t.Fatalf("NewLock() error - %v", err)
+			}
+
+			rw := byte((1 << ModeR) | (1 << ModeW))
+			srv, srvPeer := newTestMem(t, testName(t, "srv"), rw)
+			srv.SetLock(l)
+			srv.Run()
+
+			var clients []*Handler
+			var peers []*testPeer
+			for _, m := range []string{"a", "b"} {
+				h, p := newTestMem(t, testName(t, m), rw)
+				h.EnableCtrl()
+				h.Run()
+				link(srv, h)
+				clients = append(clients, h)
+				peers = append(peers, p)
+			}
+
+			// Replace client indexes of messages with client infos
+			msg := func(s string) string {
+				split := strings.Split(s, " ")
+				holder := split[len(split)-1]
+				if holder != "none" {
+					i := int(holder[0] - '0')
+					split[len(split)-1] = *clients[i].GetRes().GetInfo()
+				}
+				return CtrlPrefix + CtrlLock + " " + *srv.GetRes().GetInfo() + " " +
+					strings.Join(split, " ") + "\n"
+			}
+
+			for i, s := range test.steps {
+				peers[s.client].write(t, s.data)
+
+				if s.srv != "" {
+					srvPeer.expect(t, s.srv)
+				} else {
+					srvPeer.expectNone(t, 50*time.Millisecond)
+				}
+				for c, p := range peers {
+					var want string
+					for _, m := range s.msgs[c] {
+						want += msg(m)
+					}
+					if want != "" {
+						p.expect(t, want)
+					} else {
+						p.expectNone(t, 10*time.Millisecond)
+					}
+				}
+				if t.Failed() {
+					t.Fatalf("Step %d is failed", i)
+				}
+			}
+		})
+	}
+}
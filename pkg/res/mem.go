@@ -0,0 +1,244 @@
+package res
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrMemPeer is error instance when a peer of a memory resource could not
+// be attached.
+var ErrMemPeer = errors.New("Memory resource is not opened or already attached")
+
+// mems is global opened memory resources by name.
+var mems = struct {
+	lock *sync.Mutex
+	mems map[string]*Mem
+}{
+	lock: &sync.Mutex{},
+	mems: make(map[string]*Mem),
+}
+
+// memPipe is an in-process pipe with an unbounded buffer. Writes never
+// block, and reads block until data is written or the pipe is closed.
+type memPipe struct {
+	lock   *sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+}
+
+// newMemPipe allocates and initializes a memory pipe.
+func newMemPipe() *memPipe {
+	p := &memPipe{lock: &sync.Mutex{}}
+	p.cond = sync.NewCond(p.lock)
+	return p
+}
+
+func (p *memPipe) Read(b []byte) (n int, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for p.buf.Len() == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return p.buf.Read(b)
+}
+
+func (p *memPipe) Write(b []byte) (n int, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n, err = p.buf.Write(b)
+	p.cond.Broadcast()
+	return n, err
+}
+
+// Close closes the pipe. Buffered data could still be read.
+func (p *memPipe) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+	return nil
+}
+
+// Mem represents an in-process pipe which tests and embedding code read
+// and write directly through a peer attached by DialMem.
+type Mem struct {
+	name string
+
+	isOpenLock *sync.Mutex
+	isOpen     bool
+	hasPeer    bool
+
+	rPipe *memPipe // Peer to resource
+	wPipe *memPipe // Resource to peer
+
+	mode byte
+}
+
+// MemPeer represents the peer side of a memory resource. Data written to
+// the peer is read from the resource, and data written to the resource is
+// read from the peer. Closing the peer closes the resource.
+type MemPeer struct {
+	r *memPipe
+	w *memPipe
+}
+
+// NewMem allocates and initializes a memory resource instance.
+func NewMem(name *string, mode byte) *Mem {
+	return &Mem{
+		name: *name,
+
+		isOpenLock: &sync.Mutex{},
+		isOpen:     false,
+		hasPeer:    false,
+
+		rPipe: nil,
+		wPipe: nil,
+
+		mode: mode,
+	}
+}
+
+// DialMem attaches a peer to the opened memory resource of the name.
+// A memory resource has only one peer while it is open.
+func DialMem(name string) (*MemPeer, error) {
+	mems.lock.Lock()
+	defer mems.lock.Unlock()
+
+	m, exist := mems.mems[name]
+	if !exist {
+		return nil, ErrMemPeer
+	}
+
+	m.isOpenLock.Lock()
+	defer m.isOpenLock.Unlock()
+
+	if m.isOpen == false || m.hasPeer == true {
+		return nil, ErrMemPeer
+	}
+	m.hasPeer = true
+	return &MemPeer{r: m.wPipe, w: m.rPipe}, nil
+}
+
+// Open allocates pipes of the memory resource. Pipes are allocated again
+// at reopen, so a new peer could be attached.
+func (res *Mem) Open() error {
+	mems.lock.Lock()
+	defer mems.lock.Unlock()
+
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == true {
+		return ErrALO
+	}
+	if _, exist := mems.mems[res.name]; exist {
+		return errors.New("Memory resource name is in use - " + res.name)
+	}
+
+	res.isOpen = true
+	res.hasPeer = false
+	res.rPipe = newMemPipe()
+	res.wPipe = newMemPipe()
+	mems.mems[res.name] = res
+	return nil
+}
+
+// Close closes pipes of the memory resource.
+func (res *Mem) Close() error {
+	mems.lock.Lock()
+	defer mems.lock.Unlock()
+
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == false {
+		return ErrALC
+	}
+
+	res.isOpen = false
+	res.rPipe.Close()
+	res.wPipe.Close()
+	delete(mems.mems, res.name)
+	return nil
+}
+
+// GetInfo get memory resource's info.
+func (res *Mem) GetInfo() *string {
+	tmp := fmt.Sprintf("%s:%s", TypeMem, res.name)
+	return &tmp
+}
+
+// getPipes returns pipes of the memory resource.
+func (res *Mem) getPipes() (rPipe *memPipe, wPipe *memPipe) {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	return res.rPipe, res.wPipe
+}
+
+func (res *Mem) Read(b []byte) (n int, err error) {
+	rPipe, _ := res.getPipes()
+	if rPipe == nil {
+		return 0, io.EOF
+	}
+	return rPipe.Read(b)
+}
+
+func (res *Mem) Write(b []byte) (n int, err error) {
+	_, wPipe := res.getPipes()
+	if wPipe == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return wPipe.Write(b)
+}
+
+// IsOpen checks open of the resource.
+func (res *Mem) IsOpen() bool {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	return res.isOpen
+}
+
+// IsRable checks resource is readable.
+func (res *Mem) IsRable() bool {
+	if res.mode&(1<<ModeR) == (1 << ModeR) {
+		return true
+	}
+	return false
+}
+
+// IsWable check resource is writeable
+func (res *Mem) IsWable() bool {
+	if res.mode&(1<<ModeW) == (1 << ModeW) {
+		return true
+	}
+	return false
+}
+
+func (p *MemPeer) Read(b []byte) (n int, err error) {
+	return p.r.Read(b)
+}
+
+func (p *MemPeer) Write(b []byte) (n int, err error) {
+	return p.w.Write(b)
+}
+
+// Close closes the peer, then the memory resource reads EOF and is closed.
+func (p *MemPeer) Close() error {
+	p.w.Close()
+	return p.r.Close()
+}
@@ -0,0 +1,64 @@
+package res
+
+import (
+	"io"
+	"testing"
+)
+
+// TestMemReopen checks a memory resource has a peer while it is open, and
+// a new peer is attached after reopen.
+func TestMemReopen(t *testing.T) {
+	name := testName(t, "mem")
+	r := NewMem(&name, (1<<ModeR)|(1<<ModeW))
+	if _, err := DialMem(name); err != ErrMemPeer {
+		t.Fatalf("DialMem() before Open() error - %v, want %v", err, ErrMemPeer)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := r.Open(); err != nil {
+			t.Fatalf("Open() %d error - %v", i, err)
+		}
+		if err := r.Open(); err != ErrALO {
+			t.Fatalf("Open() %d again error - %v, want %v", i, err, ErrALO)
+		}
+		other := NewMem(&name, (1<<ModeR)|(1<<ModeW))
+		if err := other.Open(); err == nil {
+			t.Fatalf("Open() %d of the same name succeeded", i)
+		}
+
+		peer, err := DialMem(name)
+		if err != nil {
+			t.Fatalf("DialMem() %d error - %v", i, err)
+		}
+		if _, err := DialMem(name); err != ErrMemPeer {
+			t.Fatalf("DialMem() %d again error - %v, want %v", i, err, ErrMemPeer)
+		}
+
+		// Data flows in both directions
+		b := make([]byte, 16)
+		peer.Write([]byte("a"))
+		if n, err := r.Read(b); err != nil || string(b[:n]) != "a" {
+			t.Fatalf("Read() %d of the resource is %q, %v", i, b[:n], err)
+		}
+		r.Write([]byte("b"))
+		if n, err := peer.Read(b); err != nil || string(b[:n]) != "b" {
+			t.Fatalf("Read() %d of the peer is %q, %v", i, b[:n], err)
+		}
+
+		// Closing the peer closes reads of the resource
+		peer.Close()
+		if _, err := r.Read(b); err != io.EOF {
+			t.Fatalf("Read() %d after peer Close() error - %v, want EOF", i, err)
+		}
+
+		if err := r.Close(); err != nil {
+			t.Fatalf("Close() %d error - %v", i, err)
+		}
+		if err := r.Close(); err != ErrALC {
+			t.Fatalf("Close() %d again error - %v, want %v", i, err, ErrALC)
+		}
+		if _, err := DialMem(name); err != ErrMemPeer {
+			t.Fatalf("DialMem() %d after Close() error - %v, want %v", i, err, ErrMemPeer)
+		}
+	}
+}
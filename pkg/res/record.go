@@ -0,0 +1,97 @@
+package res
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record directions.
+const (
+	RecordRead  = "R"
+	RecordWrite = "W"
+)
+
+// Tap defines the interface to receive a copy of data read from or
+// written to a resource. src is the origin of written data.
+type Tap interface {
+	Tap(dir string, h *Handler, src *Handler, b []byte)
+}
+
+// Record represents data read from or written to a resource. Data is
+// encoded with base64 in JSON.
+type Record struct {
+	Time time.Time `json:"time"`
+	Dir  string    `json:"dir"`
+	Res  string    `json:"res"`
+	Src  string    `json:"src,omitempty"`
+	Data []byte    `json:"data"`
+}
+
+// recorders is global recorders by file path.
+var recorders = struct {
+	lock      *sync.Mutex
+	recorders map[string]*Recorder
+}{
+	lock:      &sync.Mutex{},
+	recorders: make(map[string]*Recorder),
+}
+
+// Recorder writes records to a recording file as JSON lines.
+type Recorder struct {
+	path string
+
+	lock *sync.Mutex
+	fp   *os.File
+	enc  *json.Encoder
+}
+
+// GetRecorder returns the recorder of the path. Handlers with the same
+// path share a recorder, so records are written to a file in order.
+func GetRecorder(path *string) (*Recorder, error) {
+	recorders.lock.Lock()
+	defer recorders.lock.Unlock()
+
+	r, exist := recorders.recorders[*path]
+	if exist {
+		return r, nil
+	}
+
+	fp, err := os.OpenFile(*path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	r = &Recorder{
+		path: *path,
+		lock: &sync.Mutex{},
+		fp:   fp,
+		enc:  json.NewEncoder(fp),
+	}
+	recorders.recorders[*path] = r
+	return r, nil
+}
+
+// NewRecord allocates and initializes a record of data.
+func NewRecord(dir string, h *Handler, src *Handler, b []byte) *Record {
+	rec := &Record{
+		Time: time.Now(),
+		Dir:  dir,
+		Res:  *h.res.GetInfo(),
+		Data: b,
+	}
+	if src != nil {
+		rec.Src = *src.res.GetInfo()
+	}
+	return rec
+}
+
+// Tap writes a record of data to the recording file.
+func (r *Recorder) Tap(dir string, h *Handler, src *Handler, b []byte) {
+	rec := NewRecord(dir, h, src, b)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.enc.Encode(rec)
+}
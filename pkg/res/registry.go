@@ -0,0 +1,210 @@
+package res
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Factory allocates a resource from resource info, which is the
+// colon-separated fields after the resource type (ex. ip, port and mode
+// of TCP:ip:port:mode). Info and mode should be checked by the factory.
+type Factory func(rInfo []string) (Res, error)
+
+// ErrRegister is error instance for wrong resource type registration.
+var ErrRegister = errors.New("Wrong resource type registration")
+
+// factories is global resource factories by resource type.
+var factories = struct {
+	lock      *sync.Mutex
+	factories map[string]Factory
+}{
+	lock:      &sync.Mutex{},
+	factories: make(map[string]Factory),
+}
+
+func init() {
+	Register(TypeTCP, newTCPRes)
+	Register(TypeUDP, newUDPRes)
+	Register(TypeUnix, newUnixRes)
+	Register(TypeFIFO, newFIFORes)
+	Register(TypeReplay, newReplayRes)
+	Register(TypeMem, newMemRes)
+	Register(TypeGen, newGenRes)
+}
+
+// Register registers a factory of the resource type, then resources of
+// the type could be allocated by New from the TYPE:info[:mode] syntax.
+// The type must be unique and must not contain colon, comma or question
+// mark.
+func Register(rType string, factory Factory) error {
+	if rType == "" || strings.ContainsAny(rType, ":,?") || factory == nil {
+		return ErrRegister
+	}
+
+	factories.lock.Lock()
+	defer factories.lock.Unlock()
+
+	if _, exist := factories.factories[rType]; exist {
+		return ErrRegister
+	}
+	factories.factories[rType] = factory
+	return nil
+}
+
+// getFactory returns the factory of the resource type.
+func getFactory(rType string) Factory {
+	factories.lock.Lock()
+	defer factories.lock.Unlock()
+
+	return factories.factories[rType]
+}
+
+// GetTypes returns registered resource types in order.
+func GetTypes() []string {
+	factories.lock.Lock()
+	defer factories.lock.Unlock()
+
+	var types []string
+	for rType := range factories.factories {
+		types = append(types, rType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// getMode returns the mode of the optional mode field. No mode field
+// means RW.
+func getMode(rInfo []string, i int) (byte, error) {
+	if len(rInfo) <= i {
+		return (byte)((1 << ModeR) | (1 << ModeW)), nil
+	}
+	if len(rInfo) > i+1 {
+		return 0, ErrInfo
+	}
+
+	mode, err := MapMode(&rInfo[i])
+	if err != nil {
+		return 0, ErrInfo
+	}
+	return mode, nil
+}
+
+// getAddr checks and returns the ip, port and mode of resource info.
+func getAddr(rInfo []string) (string, int, byte, error) {
+	if len(rInfo) < 2 {
+		return "", 0, 0, ErrInfo
+	}
+
+	ip := rInfo[0]
+	port, err := strconv.Atoi(rInfo[1])
+	if net.ParseIP(ip) == nil || err != nil ||
+		!(port >= 0 && port <= 65535) {
+		return "", 0, 0, ErrInfo
+	}
+
+	mode, err := getMode(rInfo, 2)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return ip, port, mode, nil
+}
+
+// getPath checks and returns the path and mode of resource info.
+func getPath(rInfo []string) (string, byte, error) {
+	if len(rInfo) < 1 {
+		return "", 0, ErrInfo
+	}
+
+	path := rInfo[0]
+	if path == "" || (path[0] != '/' && path[0] != '.') {
+		return "", 0, ErrInfo
+	}
+
+	mode, err := getMode(rInfo, 1)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, mode, nil
+}
+
+// newTCPRes is the factory of TCP resources.
+func newTCPRes(rInfo []string) (Res, error) {
+	ip, port, mode, err := getAddr(rInfo)
+	if err != nil {
+		return nil, err
+	}
+	return NewTCP(&ip, port, mode), nil
+}
+
+// newUDPRes is the factory of UDP resources.
+func newUDPRes(rInfo []string) (Res, error) {
+	ip, port, mode, err := getAddr(rInfo)
+	if err != nil {
+		return nil, err
+	}
+	return NewUDP(&ip, port, mode), nil
+}
+
+// newUnixRes is the factory of UNIX domain socket resources.
+func newUnixRes(rInfo []string) (Res, error) {
+	path, mode, err := getPath(rInfo)
+	if err != nil {
+		return nil, err
+	}
+	return NewUnix(&path, mode), nil
+}
+
+// newFIFORes is the factory of FIFO resources.
+func newFIFORes(rInfo []string) (Res, error) {
+	path, mode, err := getPath(rInfo)
+	if err != nil {
+		return nil, err
+	}
+	return NewFIFO(&path, mode), nil
+}
+
+// newReplayRes is the factory of replay resources.
+func newReplayRes(rInfo []string) (Res, error) {
+	if len(rInfo) != 1 || rInfo[0] == "" {
+		return nil, ErrInfo
+	}
+	return NewReplay(&rInfo[0]), nil
+}
+
+// newMemRes is the factory of memory resources.
+func newMemRes(rInfo []string) (Res, error) {
+	if len(rInfo) < 1 || rInfo[0] == "" {
+		return nil, ErrInfo
+	}
+
+	mode, err := getMode(rInfo, 1)
+	if err != nil {
+		return nil, err
+	}
+	return NewMem(&rInfo[0], mode), nil
+}
+
+// newGenRes is the factory of generator resources.
+func newGenRes(rInfo []string) (Res, error) {
+	if len(rInfo) < 2 || len(rInfo) > 3 {
+		return nil, ErrInfo
+	}
+
+	rate, err := strconv.ParseFloat(rInfo[1], 64)
+	if err != nil {
+		return nil, ErrInfo
+	}
+
+	count := 0
+	if len(rInfo) == 3 {
+		count, err = strconv.Atoi(rInfo[2])
+		if err != nil {
+			return nil, ErrInfo
+		}
+	}
+	return NewGen(&rInfo[0], rate, count)
+}
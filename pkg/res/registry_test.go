@@ -0,0 +1,119 @@
+package res
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRegister checks resource types are registered once with valid types,
+// and resources of registered types are allocated by New.
+func TestRegister(t *testing.T) {
+	factory := func(rInfo []string) (Res, error) {
+		if len(rInfo) != 1 {
+			return nil, ErrInfo
+		}
+		return NewMem(&rInfo[0], (1<<ModeR)|(1<<ModeW)), nil
+	}
+
+	// Types are unique in the process
+	rType := fmt.Sprintf("TEST%d", time.Now().UnixNano())
+
+	tests := []struct {
+		name    string
+		rType   string
+		factory Factory
+		err     bool
+	}{
+		{name: "empty", rType: "", factory: factory, err: true},
+		{name: "colon", rType: "A:B", factory: factory, err: true},
+		{name: "comma", rType: "A,B", factory: factory, err: true},
+		{name: "question", rType: "A?B", factory: factory, err: true},
+		{name: "nil", rType: rType, factory: nil, err: true},
+		{name: "builtin", rType: TypeTCP, factory: factory, err: true},
+		{name: "custom", rType: rType, factory: factory},
+		{name: "duplicate", rType: rType, factory: factory, err: true},
+	}
+
+	for _, test := range tests {
+		err := Register(test.rType, test.factory)
+		if (err != nil) != test.err {
+			t.Errorf("%s: Register(%q) error - %v, want error %v", test.name,
+				test.rType, err, test.err)
+		}
+	}
+
+	if !CheckType(rType) {
+		t.Errorf("CheckType(%q) is false", rType)
+	}
+	types := GetTypes()
+	if !sort.StringsAreSorted(types) {
+		t.Errorf("GetTypes() is not sorted - %v", types)
+	}
+	if !strings.Contains(strings.Join(types, ","), rType) {
+		t.Errorf("GetTypes() has no %s - %v", rType, types)
+	}
+
+	r, err := New(&rType, []string{"custom"})
+	if err != nil {
+		t.Fatalf("New() of %s error - %v", rType, err)
+	}
+	if info := *r.GetInfo(); info != TypeMem+":custom" {
+		t.Errorf("GetInfo() is %q, want %q", info, TypeMem+":custom")
+	}
+	if _, err := New(&rType, nil); err != ErrInfo {
+		t.Errorf("New() of %s without info error - %v, want %v", rType, err, ErrInfo)
+	}
+}
+
+// TestNew checks resource info of built-in resource types.
+func TestNew(t *testing.T) {
+	tests := []struct {
+		rType string
+		rInfo string
+		err   error
+		r     bool
+		w     bool
+	}{
+		{rType: TypeTCP, rInfo: "127.0.0.1:5000", r: true, w: true},
+		{rType: TypeTCP, rInfo: "127.0.0.1:5000:R", r: true},
+		{rType: TypeUDP, rInfo: "127.0.0.1:5000:W", w: true},
+		{rType: TypeTCP, rInfo: "127.0.0.1", err: ErrInfo},
+		{rType: TypeTCP, rInfo: "localhost:5000", err: ErrInfo},
+		{rType: TypeTCP, rInfo: "127.0.0.1:70000", err: ErrInfo},
+		{rType: TypeTCP, rInfo: "127.0.0.1:5000:X", err: ErrInfo},
+		{rType: TypeTCP, rInfo: "127.0.0.1:5000:R:W", err: ErrInfo},
+		{rType: TypeUnix, rInfo: "/tmp/sbps.sock", r: true, w: true},
+		{rType: TypeFIFO, rInfo: "./sbps.fifo:R", r: true},
+		{rType: TypeUnix, rInfo: "sbps.sock", err: ErrInfo},
+		{rType: TypeReplay, rInfo: "/tmp/record", r: true},
+		{rType: TypeReplay, rInfo: "", err: ErrInfo},
+		{rType: TypeMem, rInfo: "a:W", w: true},
+		{rType: TypeMem, rInfo: "", err: ErrInfo},
+		{rType: TypeGen, rInfo: "COUNTER:10:5", r: true},
+		{rType: TypeGen, rInfo: "COUNTER:fast", err: ErrInfo},
+		{rType: TypeConn, rInfo: "127.0.0.1:5000", err: ErrType},
+		{rType: "UNKNOWN", rInfo: "a", err: ErrType},
+	}
+
+	for _, test := range tests {
+		rInfo := strings.Split(test.rInfo, ":")
+		if test.rInfo == "" {
+			rInfo = nil
+		}
+		r, err := New(&test.rType, rInfo)
+		if err != test.err {
+			t.Errorf("New(%s, %q) error - %v, want %v", test.rType, test.rInfo, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if r.IsRable() != test.r || r.IsWable() != test.w {
+			t.Errorf("New(%s, %q) mode is R %v W %v, want R %v W %v", test.rType,
+				test.rInfo, r.IsRable(), r.IsWable(), test.r, test.w)
+		}
+	}
+}
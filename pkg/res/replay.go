@@ -0,0 +1,202 @@
+package res
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSpeed is error instance for wrong replay speed.
+var ErrSpeed = errors.New("Wrong replay speed")
+
+// Replay represents a read only resource which plays read records of
+// a recording file back at original or scaled speed. Only records of
+// server resources are played unless the resource info of records is set,
+// because records of clients are read from clients.
+type Replay struct {
+	fp     *os.File
+	reader *bufio.Reader
+	path   string
+
+	isOpenLock *sync.Mutex
+	isOpen     bool
+	quit       chan struct{}
+
+	speed float64
+	loop  bool
+	res   string
+
+	start   time.Time
+	first   time.Time
+	pending []byte
+}
+
+// NewReplay allocates and initializes a replay instance.
+func NewReplay(path *string) *Replay {
+	return &Replay{
+		fp:     nil,
+		reader: nil,
+		path:   *path,
+
+		isOpenLock: &sync.Mutex{},
+		isOpen:     false,
+
+		speed: 1,
+		loop:  false,
+		res:   "",
+	}
+}
+
+// SetSpeed sets the speed scale of replay. 2 plays twice as fast.
+func (res *Replay) SetSpeed(speed float64) error {
+	if speed <= 0 {
+		return ErrSpeed
+	}
+	res.speed = speed
+	return nil
+}
+
+// SetLoop sets whether the recording is played repeatedly.
+func (res *Replay) SetLoop(loop bool) {
+	res.loop = loop
+}
+
+// SetRes sets the resource info of records to play. Empty info means
+// records of all server resources.
+func (res *Replay) SetRes(info *string) {
+	res.res = *info
+}
+
+// Open opens the recording file and starts replay.
+func (res *Replay) Open() error {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == true {
+		return ErrALO
+	}
+
+	fp, errOpen := os.Open(res.path)
+	if errOpen != nil {
+		return errOpen
+	}
+
+	res.isOpen = true
+	res.fp = fp
+	res.reader = bufio.NewReader(fp)
+	res.quit = make(chan struct{})
+	res.first = time.Time{}
+	res.pending = nil
+	return nil
+}
+
+// Close closes the recording file.
+func (res *Replay) Close() error {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	if res.isOpen == false {
+		return ErrALC
+	}
+
+	res.isOpen = false
+	close(res.quit)
+	return res.fp.Close()
+}
+
+// GetInfo get replay resource's info.
+func (res *Replay) GetInfo() *string {
+	tmp := fmt.Sprintf("%s:%s", TypeReplay, res.path)
+	return &tmp
+}
+
+// next returns the next read record to play.
+func (res *Replay) next() (*Record, error) {
+	for {
+		line, err := res.reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 && res.loop && !res.first.IsZero() {
+			// Play again from the start
+			if _, err := res.fp.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			res.reader.Reset(res.fp)
+			res.first = time.Time{}
+			continue
+		} else if err != nil && len(line) == 0 {
+			return nil, err
+		}
+
+		rec := &Record{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			return nil, err
+		}
+		if rec.Dir != RecordRead || (res.res == "" && isClientInfo(rec.Res)) ||
+			(res.res != "" && rec.Res != res.res) {
+			continue
+		}
+		return rec, nil
+	}
+}
+
+// isClientInfo checks the resource info is info of a client resource.
+func isClientInfo(info string) bool {
+	return strings.HasPrefix(info, TypeConn+":") || strings.HasPrefix(info, TypeHTTP+":")
+}
+
+func (res *Replay) Read(b []byte) (n int, err error) {
+	if len(res.pending) > 0 {
+		n = copy(b, res.pending)
+		res.pending = res.pending[n:]
+		return n, nil
+	}
+
+	rec, err := res.next()
+	if err != nil {
+		return 0, err
+	}
+
+	// Wait the time of the record from the first record
+	if res.first.IsZero() {
+		res.first = rec.Time
+		res.start = time.Now()
+	}
+	due := res.start.Add(time.Duration(float64(rec.Time.Sub(res.first)) / res.speed))
+	select {
+	case <-time.After(time.Until(due)):
+	case <-res.quit:
+		return 0, io.EOF
+	}
+
+	n = copy(b, rec.Data)
+	res.pending = rec.Data[n:]
+	return n, nil
+}
+
+// Write discards data because replay is read only.
+func (res *Replay) Write(b []byte) (n int, err error) {
+	return len(b), nil
+}
+
+// IsOpen checks open of the resource.
+func (res *Replay) IsOpen() bool {
+	res.isOpenLock.Lock()
+	defer res.isOpenLock.Unlock()
+
+	return res.isOpen
+}
+
+// IsRable checks resource is readable.
+func (res *Replay) IsRable() bool {
+	return true
+}
+
+// IsWable check resource is writeable
+func (res *Replay) IsWable() bool {
+	return false
+}
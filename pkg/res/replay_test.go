@@ -0,0 +1,152 @@
+package res
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testConnRes is a memory resource with the info of a connection client.
+type testConnRes struct {
+	*Mem
+	info string
+}
+
+// GetInfo returns the info of the connection client.
+func (res *testConnRes) GetInfo() *string {
+	return &res.info
+}
+
+// newTestConn opens a memory resource with the info of a connection client
+// and returns the running handler of the resource and the peer.
+func newTestConn(t *testing.T, name string, info string) (*Handler, *testPeer) {
+	t.Helper()
+
+	r := &testConnRes{Mem: NewMem(&name, (1<<ModeR)|(1<<ModeW)), info: info}
+	if err := r.Open(); err != nil {
+		t.Fatalf("Open() of %s error - %v", name, err)
+	}
+	h := NewHandler(r, nil)
+	p := newTestPeer(t, name)
+	h.Run()
+
+	t.Cleanup(func() {
+		h.Stop()
+		h.Close()
+		r.Close()
+	})
+	return h, p
+}
+
+// record records data between a server resource and a client resource,
+// and returns the path of the recording file with the infos of them.
+func record(t *testing.T) (path string, sInfo string, cInfo string) {
+	t.Helper()
+
+	path = filepath.Join(t.TempDir(), "record")
+	recorder, err := GetRecorder(&path)
+	if err != nil {
+		t.Fatalf("GetRecorder() error - %v", err)
+	}
+
+	sResH, sPeer := newTestMemRW(t, testName(t, "rec-server"))
+	cInfo = TypeConn + ":127.0.0.1:10000"
+	cResH, cPeer := newTestConn(t, testName(t, "rec-client"), cInfo)
+	sResH.AddTap(recorder)
+	cResH.AddTap(recorder)
+	link(sResH, cResH)
+
+	sPeer.write(t, "a\n")
+	cPeer.expect(t, "a\n")
+	cPeer.write(t, "x\n")
+	sPeer.expect(t, "x\n")
+	time.Sleep(50 * time.Millisecond)
+	sPeer.write(t, "b\n")
+	cPeer.expect(t, "b\n")
+	return path, *sResH.res.GetInfo(), cInfo
+}
+
+// TestReplay checks read records of a recording are played back, and
+// records of clients are only played if the info of them is set.
+func TestReplay(t *testing.T) {
+	path, sInfo, cInfo := record(t)
+
+	tests := []struct {
+		name string
+		res  string
+		want string
+	}{
+		{name: "default", res: "", want: "a\nb\n"},
+		{name: "server", res: sInfo, want: "a\nb\n"},
+		{name: "client", res: cInfo, want: "x\n"},
+		{name: "unknown", res: "MEM:unknown", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewReplay(&path)
+			r.SetRes(&test.res)
+			if err := r.SetSpeed(10); err != nil {
+				t.Fatalf("SetSpeed() error - %v", err)
+			}
+			if err := r.Open(); err != nil {
+				t.Fatalf("Open() error - %v", err)
+			}
+			h := NewHandler(r, nil)
+			defer func() {
+				h.Stop()
+				h.Close()
+				r.Close()
+			}()
+
+			cResH, peer := newTestMemRW(t, testName(t, "client"))
+			link(h, cResH)
+			h.Run()
+
+			peer.expect(t, test.want)
+			peer.expectNone(t, 100*time.Millisecond)
+		})
+	}
+}
+
+// TestReplayRestart checks a replay handler can be stopped and run again.
+func TestReplayRestart(t *testing.T) {
+	path, _, _ := record(t)
+
+	r := NewReplay(&path)
+	r.SetLoop(true)
+	if err := r.SetSpeed(10); err != nil {
+		t.Fatalf("SetSpeed() error - %v", err)
+	}
+	if err := r.Open(); err != nil {
+		t.Fatalf("Open() error - %v", err)
+	}
+	h := NewHandler(r, nil)
+	defer func() {
+		h.Close()
+		r.Close()
+	}()
+
+	cResH, peer := newTestMemRW(t, testName(t, "client"))
+	link(h, cResH)
+
+	for i := 0; i < 3; i++ {
+		h.Run()
+		select {
+		case <-peer.data:
+		case <-time.After(testTimeout):
+			t.Fatalf("Read timeout after run %d", i)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			h.Stop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(testTimeout):
+			t.Fatalf("Stop() timeout after run %d", i)
+		}
+	}
+}
@@ -1,9 +1,8 @@
 package res
 
 import (
+	"bytes"
 	"errors"
-	"net"
-	"strconv"
 	"strings"
 )
 
@@ -14,6 +13,11 @@ const (
 	TypeUnix = "UNIX"
 	TypeConn = "CONN"
 	TypeFIFO = "FIFO"
+	TypeHTTP = "HTTP"
+
+	TypeReplay = "REPLAY"
+	TypeMem    = "MEM"
+	TypeGen    = "GEN"
 
 	ModeR = 0
 	ModeW = 1
@@ -46,76 +50,25 @@ type Res interface {
 	IsWable() bool
 }
 
-// New allocates and initializes a res instance
-// depends on resource Type. TypeConn is not supported.
+// New allocates and initializes a res instance by the factory of the
+// registered resource type. TypeConn and TypeHTTP are not supported.
 func New(rType *string, rInfo []string) (Res, error) {
-	mode := (byte)((1 << ModeR) | (1 << ModeW))
-
-	switch *rType {
-	case TypeTCP, TypeUDP:
-		// Check rInfo
-		ip := rInfo[0]
-		port, err := strconv.Atoi(rInfo[1])
-		if net.ParseIP(ip) == nil || err != nil ||
-			!(port >= 0 && port <= 65535) {
-			return nil, ErrInfo
-		}
-
-		if len(rInfo) >= 3 {
-			tmpMode, err := MapMode(&rInfo[2])
-			if err != nil {
-				return nil, ErrInfo
-			}
-
-			mode = tmpMode
-		}
-
-		// Allocate a resource
-		if strings.Compare(TypeTCP, *rType) == 0 {
-			return NewTCP(&ip, port, mode), nil
-		}
-		return NewUDP(&ip, port, mode), nil
-
-	case TypeUnix, TypeFIFO:
-		// Check rInfo
-		path := rInfo[0]
-		if path[0] != '/' && path[0] != '.' {
-			return nil, ErrInfo
-		}
-
-		if len(rInfo) >= 2 {
-			tmpMode, err := MapMode(&rInfo[1])
-			if err != nil {
-				return nil, ErrInfo
-			}
-			mode = tmpMode
-		}
-
-		// Allocate a resource
-		if strings.Compare(TypeUnix, *rType) == 0 {
-			return NewUnix(&path, mode), nil
-		}
-		return NewFIFO(&path, mode), nil
-
-	default:
+	factory := getFactory(*rType)
+	if factory == nil {
+		return nil, ErrType
 	}
-
-	return nil, ErrType
+	return factory(rInfo)
 }
 
 // CheckType checks resource type
 func CheckType(rType string) bool {
 	switch rType {
-	case TypeTCP:
-	case TypeUDP:
-	case TypeUnix:
-	case TypeConn:
-	case TypeFIFO:
+	case TypeConn, TypeHTTP:
 		return true
 	default:
 	}
 
-	return false
+	return getFactory(rType) != nil
 }
 
 // MapMode mapping a mode option to a byte.
@@ -130,3 +83,29 @@ func MapMode(rType *string) (byte, error) {
 	}
 	return 0, errors.New("Wrong mode")
 }
+
+// splitLines splits data following the partial line in rest into lines
+// ending with a newline. The trailing partial line is kept in rest and
+// completed by the next data of the stream. A partial line as long as max
+// is split as a line.
+func splitLines(rest *[]byte, b []byte, max int) [][]byte {
+	if len(*rest) > 0 {
+		b = append(*rest, b...)
+		*rest = nil
+	}
+
+	var lines [][]byte
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			if len(b) < max {
+				*rest = append([]byte(nil), b...)
+				break
+			}
+			i = len(b) - 1
+		}
+		lines = append(lines, b[:i+1])
+		b = b[i+1:]
+	}
+	return lines
+}
@@ -0,0 +1,142 @@
+package res
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/log"
+)
+
+func init() {
+	level := log.OptCrit
+	format := log.OptText
+	log.Init(nil, &level, &format, nil, nil)
+}
+
+// testTimeout is the timeout to wait data in tests.
+const testTimeout = 2 * time.Second
+
+// testPeer is a peer of a memory resource which reads data in background.
+type testPeer struct {
+	*MemPeer
+	data chan []byte
+}
+
+// newTestMem opens a memory resource of the name and returns the stopped
+// handler of the resource and the peer. They are closed at the end of
+// the test.
+func newTestMem(t *testing.T, name string, mode byte) (*Handler, *testPeer) {
+	t.Helper()
+
+	r := NewMem(&name, mode)
+	if err := r.Open(); err != nil {
+		t.Fatalf("Open() of %s error - %v", name, err)
+	}
+	h := NewHandler(r, nil)
+	p := newTestPeer(t, name)
+
+	t.Cleanup(func() {
+		h.Stop()
+		h.Close()
+		r.Close()
+	})
+	return h, p
+}
+
+// newTestPeer dials the opened memory resource of the name. The peer is
+// closed at the end of the test.
+func newTestPeer(t *testing.T, name string) *testPeer {
+	t.Helper()
+
+	peer, err := DialMem(name)
+	if err != nil {
+		t.Fatalf("DialMem() of %s error - %v", name, err)
+	}
+	p := &testPeer{MemPeer: peer, data: make(chan []byte, 64)}
+	go func() {
+		defer close(p.data)
+		for {
+			b := make([]byte, ReadBufSize)
+			n, err := p.Read(b)
+			if err != nil {
+				return
+			}
+			p.data <- b[:n]
+		}
+	}()
+
+	t.Cleanup(func() {
+		p.Close()
+	})
+	return p
+}
+
+// newTestMemRW opens a readable and writable memory resource, and runs the
+// handler of the resource.
+func newTestMemRW(t *testing.T, name string) (*Handler, *testPeer) {
+	t.Helper()
+
+	h, p := newTestMem(t, name, (1<<ModeR)|(1<<ModeW))
+	h.Run()
+	return h, p
+}
+
+// testName returns a unique resource name of the test.
+func testName(t *testing.T, name string) string {
+	return strings.Replace(t.Name(), "/", "-", -1) + "-" + name
+}
+
+// expect reads data from the peer until the size of want, and checks the
+// data is want.
+func (p *testPeer) expect(t *testing.T, want string) {
+	t.Helper()
+
+	var got []byte
+	timer := time.NewTimer(testTimeout)
+	defer timer.Stop()
+	for len(got) < len(want) {
+		select {
+		case b, ok := <-p.data:
+			if !ok {
+				t.Fatalf("Peer is closed - got %q, want %q", got, want)
+			}
+			got = append(got, b...)
+		case <-timer.C:
+			t.Fatalf("Read timeout - got %q, want %q", got, want)
+		}
+	}
+	if string(got) != want {
+		t.Fatalf("Read %q, want %q", got, want)
+	}
+}
+
+// expectNone checks no data is read from the peer for the duration.
+func (p *testPeer) expectNone(t *testing.T, d time.Duration) {
+	t.Helper()
+
+	select {
+	case b, ok := <-p.data:
+		if ok {
+			t.Fatalf("Read %q, want nothing", b)
+		}
+	case <-time.After(d):
+	}
+}
+
+// write writes data to the peer, then the handler of the resource reads
+// the data.
+func (p *testPeer) write(t *testing.T, data string) {
+	t.Helper()
+
+	if _, err := p.Write([]byte(data)); err != nil {
+		t.Fatalf("Write() to peer error - %v", err)
+	}
+}
+
+// link sets write target handlers between a server resource handler and
+// a client resource handler like the server.
+func link(sResH *Handler, cResH *Handler) {
+	sResH.AddWriteTarget(cResH)
+	cResH.AddWriteTarget(sResH)
+}
@@ -0,0 +1,91 @@
+package res
+
+import (
+	"sync/atomic"
+	"syscall"
+)
+
+// spliceGen is the generation of write targets and filters of all
+// handlers. It is increased when they are changed, so handlers check the
+// splice target again only after changes.
+var spliceGen uint32
+
+// invalidateSplice invalidates splice targets of all handlers.
+func invalidateSplice() {
+	atomic.AddUint32(&spliceGen, 1)
+}
+
+// Rawer is implemented by resources which expose the raw connection
+// for zero-copy relay.
+type Rawer interface {
+	SyscallConn() (syscall.RawConn, error)
+}
+
+// getRawConn returns the raw connection of a resource.
+func getRawConn(r Res) syscall.RawConn {
+	rawer, ok := r.(Rawer)
+	if !ok {
+		return nil
+	}
+
+	rc, err := rawer.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	return rc
+}
+
+// getSpliceTarget returns the only write target if data read from the
+// resource could be relayed without inspection. Otherwise, it returns nil.
+// The target is cached until write targets or filters are changed, and
+// only states of the target which change without them are checked again.
+// It is called only in the read goroutine.
+func (h *Handler) getSpliceTarget() *Handler {
+	gen := atomic.LoadUint32(&spliceGen)
+	if !h.spliceValid || h.spliceGen != gen {
+		h.spliceTarget = h.findSpliceTarget()
+		h.spliceGen = gen
+		h.spliceValid = true
+	}
+
+	// Queued data of the target must be written before spliced data
+	target := h.spliceTarget
+	if target == nil || !target.isRunning() || target.GetPending() > 0 {
+		return nil
+	}
+	return target
+}
+
+// findSpliceTarget finds the splice target among write targets.
+func (h *Handler) findSpliceTarget() *Handler {
+	// Data is inspected or modified in the handler
+	if h.isCtrl || h.group != nil || h.corr != nil || h.echo != nil ||
+		h.rTrans != nil || h.limiter != nil || len(h.taps) > 0 ||
+		len(h.interceptors) > 0 {
+		return nil
+	}
+	if rFilter, _ := h.getFilters(); rFilter != nil {
+		return nil
+	}
+
+	targets := h.getAllWriteTargets()
+	if len(targets) != 1 {
+		return nil
+	}
+
+	// Data is inspected or modified in the target
+	target := targets[0]
+	if target.wTrans != nil || target.wTimeout > 0 || target.lock != nil ||
+		target.corr != nil || target.echo != nil || target.group != nil ||
+		len(target.taps) > 0 || len(target.interceptors) > 0 {
+		return nil
+	}
+	if _, wFilter := target.getFilters(); wFilter != nil {
+		return nil
+	}
+	if !target.res.IsWable() {
+		return nil
+	}
+
+	return target
+}
@@ -0,0 +1,137 @@
+//go:build linux
+// +build linux
+
+package res
+
+import (
+	"syscall"
+)
+
+// constants for splice
+const (
+	spliceSize  = 64 * 1024
+	spliceFlags = 0x1 | 0x2 // SPLICE_F_MOVE | SPLICE_F_NONBLOCK
+)
+
+// splice relays data from the resource to the only write target through
+// a pipe by splice(2) without copying data to user space. It returns
+// false if data should be relayed by the normal read path.
+func (h *Handler) splice() bool {
+	if h.noSplice {
+		return false
+	}
+
+	target := h.getSpliceTarget()
+	if target == nil {
+		return false
+	}
+	srcRC := getRawConn(h.res)
+	dstRC := getRawConn(target.res)
+	if srcRC == nil || dstRC == nil {
+		return false
+	}
+
+	var p [2]int
+	err := syscall.Pipe2(p[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK)
+	if err != nil {
+		h.logger().WithErr(err).Errorf("Res handler - %s - read goroutine - pipe error - %s",
+			*h.res.GetInfo(), err.Error())
+		return false
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+
+	h.logger().Debugf("Res handler - %s - read goroutine - splice to %s - start",
+		*h.res.GetInfo(), *target.res.GetInfo())
+	defer h.logger().Debugf("Res handler - %s - read goroutine - splice to %s - stop",
+		*h.res.GetInfo(), *target.res.GetInfo())
+
+	for h.isRunning() {
+		// Splice from the resource to the pipe. Falls back to the normal
+		// path when write targets are changed while waiting data.
+		var n int
+		var spliceErr error
+		isChanged := false
+		err := srcRC.Read(func(fd uintptr) bool {
+			if h.getSpliceTarget() != target {
+				isChanged = true
+				return true
+			}
+
+			tmp, e := syscall.Splice(int(fd), nil, p[1], nil, spliceSize, spliceFlags)
+			if e == syscall.EAGAIN {
+				return false
+			}
+			n, spliceErr = int(tmp), e
+			return true
+		})
+		if isChanged {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+		if spliceErr != nil {
+			// The resource does not support splice
+			h.logger().WithErr(spliceErr).Infof("Res handler - %s - read goroutine - "+
+				"splice is not supported - %s", *h.res.GetInfo(), spliceErr.Error())
+			h.noSplice = true
+			return false
+		}
+		if n == 0 {
+			// Resource (connection) is closed
+			h.logger().Infof("Res handler - %s - resource is closed", *h.res.GetInfo())
+			h.disconnect()
+			return true
+		}
+
+		// Splice from the pipe to the write target
+		target.wLock.Lock()
+		for n > 0 {
+			var m int
+			err = dstRC.Write(func(fd uintptr) bool {
+				tmp, e := syscall.Splice(p[0], nil, int(fd), nil, n, spliceFlags)
+				if e == syscall.EAGAIN {
+					return false
+				}
+				m, spliceErr = int(tmp), e
+				return true
+			})
+			if err == nil {
+				err = spliceErr
+			}
+			if err != nil {
+				target.wLock.Unlock()
+				h.logger().WithErr(err).Errorf("Res handler - %s - read goroutine - "+
+					"splice to write target error - %s",
+					*h.res.GetInfo(), err.Error())
+
+				// The write target does not support splice
+				if err == syscall.EINVAL {
+					h.noSplice = true
+				}
+				h.drainPipe(p[0])
+				return false
+			}
+			n -= m
+		}
+		target.wLock.Unlock()
+	}
+
+	return true
+}
+
+// drainPipe reads data left in the pipe after splice to the write target
+// is failed, and routes the data by the normal path.
+func (h *Handler) drainPipe(fd int) {
+	for {
+		buf := h.bufPool.Get()
+		n, err := syscall.Read(fd, buf.Bytes())
+		if err != nil || n <= 0 {
+			buf.Release()
+			return
+		}
+		h.route(buf, buf.Bytes()[:n])
+		buf.Release()
+	}
+}
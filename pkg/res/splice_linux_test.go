@@ -0,0 +1,178 @@
+package res
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// acceptTCP listens a local TCP port and returns the listener and the
+// port. It is closed at the end of the test.
+func acceptTCP(t *testing.T) (net.Listener, int) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error - %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+// expectConn reads data from the connection until the size of want, and
+// checks the data is want.
+func expectConn(t *testing.T, c net.Conn, want string) {
+	t.Helper()
+
+	b := make([]byte, len(want))
+	c.SetReadDeadline(time.Now().Add(testTimeout))
+	if _, err := io.ReadFull(c, b); err != nil {
+		t.Fatalf("Read() error - %v", err)
+	}
+	if string(b) != want {
+		t.Fatalf("Read %q, want %q", b, want)
+	}
+}
+
+// TestSplice checks data is relayed between TCP sockets, and relayed by
+// the normal path after another write target is added or removed.
+func TestSplice(t *testing.T) {
+	rw := byte((1 << ModeR) | (1 << ModeW))
+
+	// Server resource connected to a backend
+	backendLn, backendPort := acceptTCP(t)
+	ip := "127.0.0.1"
+	sRes := NewTCP(&ip, backendPort, rw)
+	if err := sRes.Open(); err != nil {
+		t.Fatalf("Open() error - %v", err)
+	}
+	backend, err := backendLn.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error - %v", err)
+	}
+	defer backend.Close()
+
+	// Client resource of a client connection
+	clientLn, clientPort := acceptTCP(t)
+	client, err := net.Dial("tcp", clientLn.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() of %d error - %v", clientPort, err)
+	}
+	defer client.Close()
+	conn, err := clientLn.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error - %v", err)
+	}
+
+	sResH := NewHandler(sRes, nil)
+	cResH := NewHandler(NewConn(&conn), nil)
+	link(sResH, cResH)
+	sResH.Run()
+	cResH.Run()
+	defer func() {
+		sResH.Close()
+		cResH.Close()
+		sRes.Close()
+		cResH.GetRes().Close()
+	}()
+
+	mem, memPeer := newTestMemRW(t, testName(t, "mem"))
+
+	tests := []struct {
+		name    string
+		add     bool
+		remove  bool
+		toMem   bool
+		request bool
+	}{
+		{name: "splice"},
+		{name: "splice request", request: true},
+		{name: "second target", add: true, toMem: true},
+		{name: "second target request", request: true},
+		{name: "removed target", remove: true},
+		{name: "removed target request", request: true},
+	}
+
+	for i, test := range tests {
+		data := test.name + "\n"
+		if test.add {
+			sResH.AddWriteTarget(mem)
+		}
+		if test.remove {
+			sResH.RemoveWriteTarget(mem)
+		}
+
+		if test.request {
+			if _, err := client.Write([]byte(data)); err != nil {
+				t.Fatalf("Step %d - Write() to client error - %v", i, err)
+			}
+			expectConn(t, backend, data)
+			continue
+		}
+
+		if _, err := backend.Write([]byte(data)); err != nil {
+			t.Fatalf("Step %d - Write() to backend error - %v", i, err)
+		}
+		expectConn(t, client, data)
+		if test.toMem {
+			memPeer.expect(t, data)
+		} else {
+			memPeer.expectNone(t, 20*time.Millisecond)
+		}
+	}
+}
+
+// TestSpliceTarget checks the splice target is found only without options
+// inspecting data, and the cached target is checked again after changes.
+func TestSpliceTarget(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(src *Handler, dst *Handler, other *Handler)
+		want  bool
+	}{
+		{name: "only target", setup: func(src, dst, other *Handler) {}, want: true},
+		{name: "two targets", setup: func(src, dst, other *Handler) {
+			src.AddWriteTarget(other)
+		}},
+		{name: "removed target", setup: func(src, dst, other *Handler) {
+			src.AddWriteTarget(other)
+			src.getSpliceTarget()
+			src.RemoveWriteTarget(other)
+		}, want: true},
+		{name: "read filter", setup: func(src, dst, other *Handler) {
+			f, _ := NewFilter([]string{"include:prefix:a"})
+			src.SetRFilter(f)
+		}},
+		{name: "write filter of target", setup: func(src, dst, other *Handler) {
+			src.getSpliceTarget()
+			f, _ := NewFilter([]string{"include:prefix:a"})
+			dst.SetWFilter(f)
+		}},
+		{name: "transform of target", setup: func(src, dst, other *Handler) {
+			c, _ := NewChain([]string{TransLF})
+			dst.SetWTransform(c)
+		}},
+		{name: "pending writes of target", setup: func(src, dst, other *Handler) {
+			atomic.StoreInt32(&dst.pending, 1)
+		}},
+		{name: "stopped target", setup: func(src, dst, other *Handler) {
+			dst.Stop()
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src, _ := newTestMem(t, testName(t, "src"), (1<<ModeR)|(1<<ModeW))
+			dst, _ := newTestMemRW(t, testName(t, "dst"))
+			other, _ := newTestMem(t, testName(t, "other"), (1<<ModeR)|(1<<ModeW))
+			src.AddWriteTarget(dst)
+
+			test.setup(src, dst, other)
+			if got := src.getSpliceTarget() == dst; got != test.want {
+				t.Errorf("getSpliceTarget() is the target - %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package res
+
+// splice is only supported on linux, so data is always relayed by
+// the normal read path.
+func (h *Handler) splice() bool {
+	return false
+}
@@ -1,9 +1,11 @@
 package res
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"syscall"
 )
 
 // TCP represents a TCP socket.
@@ -78,6 +80,15 @@ func (res *TCP) Write(b []byte) (n int, err error) {
 	return res.conn.Write(b)
 }
 
+// SyscallConn returns the raw connection of the TCP socket.
+func (res *TCP) SyscallConn() (syscall.RawConn, error) {
+	c, ok := res.conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("Do not support SyscallConn()")
+	}
+	return c.SyscallConn()
+}
+
 // IsOpen checks open of the resource.
 func (res *TCP) IsOpen() bool {
 	res.isOpenLock.Lock()
@@ -0,0 +1,125 @@
+package res
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Built-in transforms.
+const (
+	TransTimestamp = "TS"
+	TransName      = "NAME"
+	TransHex       = "HEX"
+	TransB64Enc    = "B64ENC"
+	TransB64Dec    = "B64DEC"
+	TransLF        = "LF"
+	TransCRLF      = "CRLF"
+	TransNoANSI    = "NOANSI"
+)
+
+// TransMaxLine is the max size of a line to transform. A partial line
+// longer than it is transformed as a line.
+const TransMaxLine = 64 * 1024
+
+// ErrTrans is error instance for wrong transform option.
+var ErrTrans = errors.New("Wrong transform option")
+
+// ansiRegexp matches ANSI CSI and OSC escape sequences.
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(\x07|\x1b\\\\)|\x1b[@-Z\\\\-_]")
+
+// Transform transforms data in flight. src is the handler which the data
+// comes from. Transform must not modify b, and returns nil to drop data.
+type Transform interface {
+	Transform(src *Handler, b []byte) []byte
+}
+
+// TransformFunc is an adapter to use a function as a transform.
+type TransformFunc func(src *Handler, b []byte) []byte
+
+// Transform calls f(src, b).
+func (f TransformFunc) Transform(src *Handler, b []byte) []byte {
+	return f(src, b)
+}
+
+// Chain represents chained transforms applied in order.
+type Chain []Transform
+
+// NewChain allocates and initializes a chain instance of built-in transforms.
+func NewChain(names []string) (Chain, error) {
+	var chain Chain
+
+	for _, name := range names {
+		switch name {
+		case TransTimestamp:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				ts := time.Now().Format(time.RFC3339Nano) + " "
+				return append([]byte(ts), b...)
+			}))
+
+		case TransName:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				name := fmt.Sprintf("[%s] ", *src.GetRes().GetInfo())
+				return append([]byte(name), b...)
+			}))
+
+		case TransHex:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				return []byte(hex.Dump(b))
+			}))
+
+		case TransB64Enc:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				return []byte(base64.StdEncoding.EncodeToString(b) + "\n")
+			}))
+
+		case TransB64Dec:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				out, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+				if err != nil {
+					src.logger().WithErr(err).Errorf("Transform - %s - base64 decode error - %s",
+						*src.GetRes().GetInfo(), err.Error())
+					return nil
+				}
+				return out
+			}))
+
+		case TransLF:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				return bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+			}))
+
+		case TransCRLF:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				lf := bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+				return bytes.Replace(lf, []byte("\n"), []byte("\r\n"), -1)
+			}))
+
+		case TransNoANSI:
+			chain = append(chain, TransformFunc(func(src *Handler, b []byte) []byte {
+				return ansiRegexp.ReplaceAll(b, nil)
+			}))
+
+		default:
+			return nil, ErrTrans
+		}
+	}
+
+	return chain, nil
+}
+
+// Apply applies transforms of the chain in order.
+// If a transform drops data, Apply returns an empty slice.
+func (c Chain) Apply(src *Handler, b []byte) []byte {
+	for _, t := range c {
+		b = t.Transform(src, b)
+		if len(b) == 0 {
+			return nil
+		}
+	}
+	return b
+}
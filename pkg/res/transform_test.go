@@ -0,0 +1,104 @@
+package res
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// TestChainApply checks built-in transforms and chains of transforms.
+func TestChainApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		in    string
+		want  string // regular expression of the output
+	}{
+		{name: "empty", names: nil, in: "a\n", want: `^a\n$`},
+		{
+			name:  "timestamp",
+			names: []string{TransTimestamp},
+			in:    "a\n",
+			want:  `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d) a\n$`,
+		},
+		{name: "name", names: []string{TransName}, in: "a\n", want: `^\[MEM:src\] a\n$`},
+		{name: "hex", names: []string{TransHex}, in: "AB", want: `^00000000  41 42 +\|AB\|\n$`},
+		{name: "base64 encode", names: []string{TransB64Enc}, in: "hello", want: `^aGVsbG8=\n$`},
+		{name: "base64 decode", names: []string{TransB64Dec}, in: "aGVsbG8=\n", want: `^hello$`},
+		{name: "base64 decode error", names: []string{TransB64Dec}, in: "!!\n", want: `^$`},
+		{name: "lf", names: []string{TransLF}, in: "a\r\nb\n", want: `^a\nb\n$`},
+		{name: "crlf", names: []string{TransCRLF}, in: "a\r\nb\n", want: `^a\r\nb\r\n$`},
+		{
+			name:  "no ansi",
+			names: []string{TransNoANSI},
+			in:    "\x1b[1;31mred\x1b[0m \x1b]0;title\x07ok\n",
+			want:  `^red ok\n$`,
+		},
+		{
+			name:  "chain in order",
+			names: []string{TransB64Enc, TransB64Dec, TransCRLF},
+			in:    "a\n",
+			want:  `^a\r\n$`,
+		},
+		{
+			name:  "dropped chain",
+			names: []string{TransB64Dec, TransName},
+			in:    "!!",
+			want:  `^$`,
+		},
+	}
+
+	name := "src"
+	src := NewHandler(NewMem(&name, (1<<ModeR)|(1<<ModeW)), nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := NewChain(test.names)
+			if err != nil {
+				t.Fatalf("NewChain() error - %v", err)
+			}
+
+			in := []byte(test.in)
+			got := c.Apply(src, in)
+			if !regexp.MustCompile(test.want).Match(got) {
+				t.Errorf("Apply(%q) is %q, want %s", test.in, got, test.want)
+			}
+			if string(in) != test.in {
+				t.Errorf("Input is modified to %q", in)
+			}
+		})
+	}
+
+	if _, err := NewChain([]string{"UNKNOWN"}); err != ErrTrans {
+		t.Errorf("NewChain() of an unknown transform error - %v, want %v", err, ErrTrans)
+	}
+}
+
+// TestChainHandler checks transforms of lines read from a server resource
+// and lines written to the server resource.
+func TestChainHandler(t *testing.T) {
+	rChain, _ := NewChain([]string{TransName, TransLF})
+	wChain, _ := NewChain([]string{TransCRLF})
+
+	srv, srvPeer := newTestMem(t, testName(t, "srv"), (1<<ModeR)|(1<<ModeW))
+	srv.SetRTransform(rChain)
+	srv.SetWTransform(wChain)
+	srv.Run()
+
+	client, clientPeer := newTestMemRW(t, testName(t, "client"))
+	link(srv, client)
+
+	// Each line is transformed, and a partial line is transformed after
+	// the rest of the line is read
+	name := "[" + *srv.GetRes().GetInfo() + "] "
+	srvPeer.write(t, "a\r\nb\r\nc")
+	clientPeer.expect(t, name+"a\n"+name+"b\n")
+	clientPeer.expectNone(t, 50*time.Millisecond)
+	srvPeer.write(t, "\r\n")
+	clientPeer.expect(t, name+"c\n")
+
+	clientPeer.write(t, "d\ne")
+	srvPeer.expect(t, "d\r\n")
+	srvPeer.expectNone(t, 50*time.Millisecond)
+	clientPeer.write(t, "\n")
+	srvPeer.expect(t, "e\r\n")
+}
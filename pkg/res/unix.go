@@ -1,9 +1,11 @@
 package res
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"syscall"
 )
 
 // Unix represents a unix domain socket.
@@ -76,6 +78,15 @@ func (res *Unix) Write(b []byte) (n int, err error) {
 	return res.conn.Write(b)
 }
 
+// SyscallConn returns the raw connection of the unix socket.
+func (res *Unix) SyscallConn() (syscall.RawConn, error) {
+	c, ok := res.conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("Do not support SyscallConn()")
+	}
+	return c.SyscallConn()
+}
+
 // IsOpen checks open of the resource.
 func (res *Unix) IsOpen() bool {
 	res.isOpenLock.Lock()
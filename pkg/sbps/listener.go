@@ -0,0 +1,142 @@
+package sbps
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/server"
+)
+
+// Listener represents a listener of clients and its options applied to
+// client resource handlers.
+type Listener struct {
+	Type string // server.TypeTCP or server.TypeUnix
+	Addr string // Port of TCP or path of UNIX
+
+	RTransform []string
+	WTransform []string
+
+	Rate      float64
+	FrameRate float64
+	RateMode  string
+
+	WriteTimeout time.Duration
+	WriteQueue   int    // 0 means no write queue, or res.WriteQueueSize for monitors
+	WritePolicy  string // "" means res.WriteDisconnect, or res.WriteDrop for monitors
+	Record       string
+}
+
+// TCPListener returns a TCP listener of the port.
+func TCPListener(port int) Listener {
+	return Listener{Type: server.TypeTCP, Addr: strconv.Itoa(port)}
+}
+
+// UnixListener returns a UNIX domain socket listener of the path.
+func UnixListener(path string) Listener {
+	return Listener{Type: server.TypeUnix, Addr: path}
+}
+
+// ParseListener parses a listener option (TYPE:opt[?key=value&...]).
+func ParseListener(opt string) (Listener, error) {
+	var l Listener
+
+	query := ""
+	if i := strings.Index(opt, "?"); i >= 0 {
+		query = opt[i+1:]
+		opt = opt[:i]
+	}
+
+	split := strings.Split(opt, ":")
+	if len(split) != 2 {
+		return l, errors.New("Wrong listener options")
+	}
+	l.Type = split[0]
+	l.Addr = split[1]
+
+	opts, err := url.ParseQuery(query)
+	if err != nil {
+		return l, err
+	}
+
+	for key := range opts {
+		value := opts.Get(key)
+
+		switch key {
+		case server.LnOptRTransform:
+			l.RTransform = opts[key]
+		case server.LnOptWTransform:
+			l.WTransform = opts[key]
+		case server.LnOptRate:
+			l.Rate, err = strconv.ParseFloat(value, 64)
+		case server.LnOptFrameRate:
+			l.FrameRate, err = strconv.ParseFloat(value, 64)
+		case server.LnOptRateMode:
+			l.RateMode = value
+		case server.LnOptWTimeout:
+			l.WriteTimeout, err = time.ParseDuration(value)
+		case server.LnOptWQueue:
+			l.WriteQueue, err = strconv.Atoi(value)
+		case server.LnOptWPolicy:
+			l.WritePolicy = value
+		case server.LnOptRecord:
+			l.Record = value
+		default:
+			return l, errors.New("Wrong listener option - " + key)
+		}
+		if err != nil {
+			return l, err
+		}
+	}
+	return l, nil
+}
+
+// newListener allocates a server listener from the fields of the listener.
+func (l *Listener) newListener() (*server.Listener, error) {
+	return server.NewListenerOpts(&l.Type, &l.Addr, l.opts())
+}
+
+// String returns the listener option of the listener.
+func (l *Listener) String() string {
+	opt := l.Type + ":" + l.Addr
+	if opts := l.opts(); len(opts) > 0 {
+		opt += "?" + opts.Encode()
+	}
+	return opt
+}
+
+// opts returns the listener options applied to client resource handlers.
+func (l *Listener) opts() url.Values {
+	opts := url.Values{}
+	if len(l.RTransform) > 0 {
+		opts[server.LnOptRTransform] = l.RTransform
+	}
+	if len(l.WTransform) > 0 {
+		opts[server.LnOptWTransform] = l.WTransform
+	}
+	if l.Rate > 0 {
+		opts.Set(server.LnOptRate, strconv.FormatFloat(l.Rate, 'f', -1, 64))
+	}
+	if l.FrameRate > 0 {
+		opts.Set(server.LnOptFrameRate, strconv.FormatFloat(l.FrameRate, 'f', -1, 64))
+	}
+	if l.RateMode != "" {
+		opts.Set(server.LnOptRateMode, l.RateMode)
+	}
+	if l.WriteTimeout > 0 {
+		opts.Set(server.LnOptWTimeout, l.WriteTimeout.String())
+	}
+	if l.WriteQueue > 0 {
+		opts.Set(server.LnOptWQueue, strconv.Itoa(l.WriteQueue))
+	}
+	if l.WritePolicy != "" {
+		opts.Set(server.LnOptWPolicy, l.WritePolicy)
+	}
+	if l.Record != "" {
+		opts.Set(server.LnOptRecord, l.Record)
+	}
+
+	return opts
+}
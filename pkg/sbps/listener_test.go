@@ -0,0 +1,55 @@
+package sbps
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/res"
+	"github.com/ssup2/sbps/pkg/server"
+)
+
+// TestParseListener checks listener options are parsed, and String returns
+// the same listener option.
+func TestParseListener(t *testing.T) {
+	tests := []struct {
+		opt  string
+		want Listener
+		err  bool
+	}{
+		{
+			opt:  "TCP:6060",
+			want: Listener{Type: server.TypeTCP, Addr: "6060"},
+		},
+		{
+			opt: "TCP:6060?wpolicy=DISCONNECT&wqueue=16&wtimeout=500ms",
+			want: Listener{Type: server.TypeTCP, Addr: "6060", WriteTimeout: 500 * time.Millisecond,
+				WriteQueue: 16, WritePolicy: res.WriteDisconnect},
+		},
+		{
+			opt: "UNIX:/tmp/sbps.sock?rate=10&ratemode=DROP&wtransform=TS",
+			want: Listener{Type: server.TypeUnix, Addr: "/tmp/sbps.sock", WTransform: []string{"TS"},
+				Rate: 10, RateMode: res.LimitDrop},
+		},
+		{opt: "TCP:6060?wqueue=many", err: true},
+		{opt: "TCP:6060?unknown=1", err: true},
+		{opt: "TCP", err: true},
+	}
+
+	for _, test := range tests {
+		l, err := ParseListener(test.opt)
+		if (err != nil) != test.err {
+			t.Errorf("ParseListener(%s) error - %v", test.opt, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if !reflect.DeepEqual(l, test.want) {
+			t.Errorf("ParseListener(%s) is %+v, want %+v", test.opt, l, test.want)
+		}
+		if got := l.String(); got != test.opt {
+			t.Errorf("String() is %s, want %s", got, test.opt)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package sbps
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+// Resource defines the interface of a typed server resource.
+type Resource interface {
+	NewRes() (res.Res, error)
+}
+
+// ResourceOption sets an option to a server resource handler.
+type ResourceOption func(p *Proxy, h *res.Handler) error
+
+// TCP represents a TCP server resource. Mode is R, W or RW, and empty mode
+// means RW.
+type TCP struct {
+	IP   string
+	Port int
+	Mode string
+}
+
+// UDP represents a UDP server resource. Mode is R, W or RW, and empty mode
+// means RW.
+type UDP struct {
+	IP   string
+	Port int
+	Mode string
+}
+
+// Unix represents a UNIX domain socket server resource. Mode is R, W or RW,
+// and empty mode means RW.
+type Unix struct {
+	Path string
+	Mode string
+}
+
+// FIFO represents a FIFO server resource. Mode is R, W or RW, and empty
+// mode means RW.
+type FIFO struct {
+	Path string
+	Mode string
+}
+
+// Replay represents a replay server resource of a recording file. Zero
+// speed means the original speed, and empty Res means records of all
+// server resources.
+type Replay struct {
+	Path  string
+	Speed float64
+	Loop  bool
+	Res   string
+}
+
+// Mem represents an in-process memory resource. The peer is attached by
+// res.DialMem with the name. Mode is R, W or RW, and empty mode means RW.
+type Mem struct {
+	Name string
+	Mode string
+}
+
+// Gen represents a generator resource. Pattern is res.GenCounter,
+// res.GenRandom[/size], res.GenFixed/payload or res.GenTime[/size], Rate
+// is frames per second and Count is the number of frames before the
+// resource is closed. 0 rate means no rate limit, and 0 count means no
+// end.
+type Gen struct {
+	Pattern string
+	Rate    float64
+	Count   int
+}
+
+// Raw wraps an allocated resource, for resources without a typed struct.
+type Raw struct {
+	Res res.Res
+}
+
+// Spec represents a server resource by a resource option
+// (TYPE:info[:mode]), for resource types registered by res.Register.
+type Spec string
+
+// newRes allocates a resource from a resource type and info.
+func newRes(rType string, rInfo ...string) (res.Res, error) {
+	if len(rInfo) > 0 && rInfo[len(rInfo)-1] == "" {
+		rInfo = rInfo[:len(rInfo)-1]
+	}
+	if len(rInfo) == 0 {
+		return nil, res.ErrInfo
+	}
+	return res.New(&rType, rInfo)
+}
+
+// NewRes allocates a TCP resource.
+func (r TCP) NewRes() (res.Res, error) {
+	return newRes(res.TypeTCP, r.IP, strconv.Itoa(r.Port), r.Mode)
+}
+
+// NewRes allocates a UDP resource.
+func (r UDP) NewRes() (res.Res, error) {
+	return newRes(res.TypeUDP, r.IP, strconv.Itoa(r.Port), r.Mode)
+}
+
+// NewRes allocates a UNIX domain socket resource.
+func (r Unix) NewRes() (res.Res, error) {
+	return newRes(res.TypeUnix, r.Path, r.Mode)
+}
+
+// NewRes allocates a FIFO resource.
+func (r FIFO) NewRes() (res.Res, error) {
+	return newRes(res.TypeFIFO, r.Path, r.Mode)
+}
+
+// NewRes allocates a memory resource.
+func (r Mem) NewRes() (res.Res, error) {
+	return newRes(res.TypeMem, r.Name, r.Mode)
+}
+
+// NewRes allocates a generator resource.
+func (r Gen) NewRes() (res.Res, error) {
+	return newRes(res.TypeGen, r.Pattern, strconv.FormatFloat(r.Rate, 'f', -1, 64),
+		strconv.Itoa(r.Count))
+}
+
+// NewRes allocates a replay resource.
+func (r Replay) NewRes() (res.Res, error) {
+	tmp, err := newRes(res.TypeReplay, r.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := tmp.(*res.Replay)
+	if r.Speed != 0 {
+		if err := replay.SetSpeed(r.Speed); err != nil {
+			return nil, err
+		}
+	}
+	replay.SetLoop(r.Loop)
+	replay.SetRes(&r.Res)
+	return replay, nil
+}
+
+// NewRes allocates a resource by the factory of the resource type.
+func (r Spec) NewRes() (res.Res, error) {
+	split := strings.Split(string(r), ":")
+	if len(split) < 2 {
+		return nil, res.ErrInfo
+	}
+	return res.New(&split[0], split[1:])
+}
+
+// NewRes returns the wrapped resource.
+func (r Raw) NewRes() (res.Res, error) {
+	if r.Res == nil {
+		return nil, res.ErrInfo
+	}
+	return r.Res, nil
+}
+
+// ResGroup adds the server resource to the group. The group must be added
+// with WithGroup.
+func ResGroup(name string) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		g := p.s.GetGroup(&name)
+		if g == nil {
+			return errors.New("Wrong group of a server resource - " + name)
+		}
+		g.AddMember(h)
+		return nil
+	}
+}
+
+// ResCorrelator sets request-response correlation of the server resource.
+func ResCorrelator(mode string, field string, timeout time.Duration) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		c, err := res.NewCorrelator(&mode, &field, timeout)
+		if err != nil {
+			return err
+		}
+		h.SetCorrelator(c)
+		return nil
+	}
+}
+
+// ResLock sets the writer lock of the server resource.
+func ResLock(mode string, policy string, idle time.Duration) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		l, err := res.NewLock(&mode, &policy, idle)
+		if err != nil {
+			return err
+		}
+		h.SetLock(l)
+		return nil
+	}
+}
+
+// ResEcho sets echo suppression of the server resource.
+func ResEcho(mode string, window time.Duration) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		e, err := res.NewEcho(&mode, window)
+		if err != nil {
+			return err
+		}
+		h.SetEcho(e)
+		return nil
+	}
+}
+
+// ResFilter sets filters of data read from the server resource.
+func ResFilter(specs ...string) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		f, err := res.NewFilter(specs)
+		if err != nil {
+			return err
+		}
+		h.SetRFilter(f)
+		return nil
+	}
+}
+
+// ResRTransform sets transforms of data read from the server resource.
+func ResRTransform(names ...string) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		c, err := res.NewChain(names)
+		if err != nil {
+			return err
+		}
+		h.SetRTransform(c)
+		return nil
+	}
+}
+
+// ResWTransform sets transforms of data written to the server resource.
+func ResWTransform(names ...string) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		c, err := res.NewChain(names)
+		if err != nil {
+			return err
+		}
+		h.SetWTransform(c)
+		return nil
+	}
+}
+
+// ResRateLimit sets the rate limit of data read from the server resource.
+// 0 rate means no limit.
+func ResRateLimit(mode string, bytesRate float64, framesRate float64) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		l, err := res.NewLimiter(&mode, bytesRate, framesRate)
+		if err != nil {
+			return err
+		}
+		h.SetLimiter(l)
+		return nil
+	}
+}
+
+// ResBufSize sets the read buffer size of the server resource.
+func ResBufSize(size int) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		if size <= 0 {
+			return errors.New("Wrong read buffer size")
+		}
+		h.SetReadBufSize(size)
+		return nil
+	}
+}
+
+// ResRecord records traffic of the server resource to the file.
+func ResRecord(path string) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		r, err := res.GetRecorder(&path)
+		if err != nil {
+			return err
+		}
+		h.AddTap(r)
+		return nil
+	}
+}
+
+// ResInterceptor adds an interceptor of the server resource. It is called
+// before global interceptors.
+func ResInterceptor(i res.Interceptor) ResourceOption {
+	return func(p *Proxy, h *res.Handler) error {
+		h.AddInterceptor(i)
+		return nil
+	}
+}
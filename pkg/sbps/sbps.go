@@ -0,0 +1,341 @@
+// Package sbps provides an embeddable sbps proxy built from typed options.
+//
+//	p, err := sbps.New(
+//		sbps.WithListener(sbps.TCPListener(6060)),
+//		sbps.WithResource(sbps.TCP{IP: "127.0.0.1", Port: 7070}),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	go p.Run(ctx)
+//	...
+//	p.Shutdown(shutdownCtx)
+package sbps
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/log"
+	"github.com/ssup2/sbps/pkg/res"
+	"github.com/ssup2/sbps/pkg/server"
+)
+
+// Default options.
+const (
+	DefaultPort     = 6060
+	DefaultInterval = 2 * time.Second
+)
+
+// pLog is the logger with the server component field.
+var pLog = log.With(log.Fields{Component: log.CompServer})
+
+// Option sets an option of a proxy.
+type Option func(p *Proxy) error
+
+// resource represents a typed server resource and its options.
+type resource struct {
+	r    Resource
+	opts []ResourceOption
+}
+
+// Proxy is an sbps instance which links server resources and clients.
+type Proxy struct {
+	ln       Listener
+	interval time.Duration
+	hub      string
+	maxRetry int
+	minOpen  int
+
+	groups       []*res.Group
+	hooks        []*server.Hook
+	interceptors []res.Interceptor
+	resources    []*resource
+
+	http          *Listener
+	monitorLn     *Listener
+	monitorFormat string
+
+	s       *server.Server
+	httpSrv *server.HTTP
+	monitor *server.Monitor
+	sResHs  []*res.Handler
+}
+
+// WithListener sets the listener of clients.
+func WithListener(l Listener) Option {
+	return func(p *Proxy) error {
+		p.ln = l
+		return nil
+	}
+}
+
+// WithRetryInterval sets the retry interval to reopen closed server
+// resources. It is rounded up to seconds. 0 means closed server resources
+// are removed.
+func WithRetryInterval(d time.Duration) Option {
+	return func(p *Proxy) error {
+		if d < 0 {
+			return errors.New("Wrong retry interval")
+		}
+		p.interval = d
+		return nil
+	}
+}
+
+// WithMaxRetry sets the maximum number of reopen retries of a closed server
+// resource. 0 means unlimited retries.
+func WithMaxRetry(n int) Option {
+	return func(p *Proxy) error {
+		p.maxRetry = n
+		return nil
+	}
+}
+
+// WithMinOpen sets the minimum number of open server resources for
+// readiness. Without it, the minimum is 0 in hub mode and 1 otherwise.
+func WithMinOpen(n int) Option {
+	return func(p *Proxy) error {
+		p.minOpen = n
+		return nil
+	}
+}
+
+// WithHub sets the client hub mode (server.HubNone, server.HubAll or
+// server.HubOthers).
+func WithHub(mode string) Option {
+	return func(p *Proxy) error {
+		p.hub = mode
+		return nil
+	}
+}
+
+// WithGroup adds a server resource group.
+func WithGroup(g *res.Group) Option {
+	return func(p *Proxy) error {
+		p.groups = append(p.groups, g)
+		return nil
+	}
+}
+
+// WithHook adds an event hook.
+func WithHook(h *server.Hook) Option {
+	return func(p *Proxy) error {
+		p.hooks = append(p.hooks, h)
+		return nil
+	}
+}
+
+// WithInterceptor adds a global interceptor of server and client
+// resources.
+func WithInterceptor(i res.Interceptor) Option {
+	return func(p *Proxy) error {
+		p.interceptors = append(p.interceptors, i)
+		return nil
+	}
+}
+
+// WithHTTP sets the HTTP listener for stream, write and status endpoints.
+func WithHTTP(l Listener) Option {
+	return func(p *Proxy) error {
+		p.http = &l
+		return nil
+	}
+}
+
+// WithMonitor sets the monitor listener and the format of monitor clients
+// (server.MonitorText or server.MonitorJSON).
+func WithMonitor(l Listener, format string) Option {
+	return func(p *Proxy) error {
+		p.monitorLn = &l
+		p.monitorFormat = format
+		return nil
+	}
+}
+
+// WithResource adds a server resource with options.
+func WithResource(r Resource, opts ...ResourceOption) Option {
+	return func(p *Proxy) error {
+		if r == nil {
+			return res.ErrInfo
+		}
+		p.resources = append(p.resources, &resource{r: r, opts: opts})
+		return nil
+	}
+}
+
+// New allocates and initializes a proxy instance from options. Listeners
+// are bound, but clients are not accepted until Run.
+func New(opts ...Option) (*Proxy, error) {
+	p := &Proxy{
+		ln:       TCPListener(DefaultPort),
+		interval: DefaultInterval,
+		hub:      server.HubNone,
+		maxRetry: 0,
+		minOpen:  -1,
+
+		monitorFormat: server.MonitorText,
+	}
+
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.init(); err != nil {
+		p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// init allocates the server, the monitor, the HTTP server and server
+// resource handlers.
+func (p *Proxy) init() error {
+	var err error
+
+	ln, err := p.ln.newListener()
+	if err != nil {
+		return err
+	}
+	p.s = server.NewWithListener(ln, int((p.interval+time.Second-1)/time.Second))
+
+	if p.minOpen >= 0 {
+		if err = p.s.SetMinOpen(p.minOpen); err != nil {
+			return err
+		}
+	}
+	if err = p.s.SetMaxRetry(p.maxRetry); err != nil {
+		return err
+	}
+	if err = p.s.SetHub(&p.hub); err != nil {
+		return err
+	}
+	for _, h := range p.hooks {
+		p.s.AddHook(h)
+	}
+	for _, i := range p.interceptors {
+		p.s.AddInterceptor(i)
+	}
+
+	// Monitor must be allocated before server resources are added
+	if p.monitorLn != nil {
+		monitorLn, err := p.monitorLn.newListener()
+		if err != nil {
+			return err
+		}
+		p.monitor, err = p.s.NewMonitorWithListener(monitorLn, &p.monitorFormat)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.http != nil {
+		httpLn, err := p.http.newListener()
+		if err != nil {
+			return err
+		}
+		p.httpSrv = p.s.NewHTTPWithListener(httpLn)
+	}
+
+	for _, g := range p.groups {
+		if err = p.s.AddGroup(g); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range p.resources {
+		sRes, err := r.r.NewRes()
+		if err != nil {
+			return err
+		}
+
+		h := res.NewHandler(sRes, p.s.GetSResHNoti())
+		for _, opt := range r.opts {
+			if err := opt(p, h); err != nil {
+				return err
+			}
+		}
+		p.sResHs = append(p.sResHs, h)
+	}
+	return nil
+}
+
+// close closes allocated servers.
+func (p *Proxy) close() {
+	if p.httpSrv != nil {
+		p.httpSrv.Close()
+	}
+	if p.monitor != nil {
+		p.monitor.Close()
+	}
+	if p.s != nil {
+		p.s.Close()
+	}
+}
+
+// Server returns the server of the proxy.
+func (p *Proxy) Server() *server.Server {
+	return p.s
+}
+
+// Run opens server resources and serves clients. It blocks until ctx is
+// done or all server resources are closed. It returns ctx's error when
+// ctx is done, and nil when all server resources are closed. Server
+// resources failed to open are retried after the retry interval, or
+// removed when the retry interval is 0.
+func (p *Proxy) Run(ctx context.Context) error {
+	if p.monitor != nil {
+		p.monitor.Run()
+	}
+
+	for _, h := range p.sResHs {
+		openError := h.GetRes().Open()
+		if openError != nil {
+			pLog.WithRes(*h.GetRes().GetInfo()).WithErr(openError).Warnf(
+				"Open of a server resource error - %s", openError.Error())
+
+			if p.interval > 0 {
+				p.s.AddSResHandler(h)
+				p.s.AddSResClosedHandler(h)
+			}
+		} else {
+			p.s.AddSResHandler(h)
+			if h.GetGroup() != nil {
+				h.GetGroup().Update()
+			}
+			h.Run()
+		}
+	}
+
+	if err := p.s.Run(); err != nil {
+		return err
+	}
+
+	if p.httpSrv != nil {
+		p.httpSrv.Run()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.s.Done():
+		return nil
+	}
+}
+
+// Shutdown closes the HTTP server and the monitor, stops accepting
+// clients, and closes the proxy after pending writes and running hooks are
+// finished. If ctx is done before, the proxy is closed immediately and
+// ctx's error is returned.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	if p.httpSrv != nil {
+		p.httpSrv.Close()
+	}
+	if p.monitor != nil {
+		p.monitor.Close()
+	}
+	return p.s.Shutdown(ctx)
+}
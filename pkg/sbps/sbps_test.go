@@ -0,0 +1,273 @@
+package sbps
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/res"
+	"github.com/ssup2/sbps/pkg/server"
+)
+
+// TestProxyWithoutLogInit checks a proxy is built, run and shut down
+// without log.Init, which embedding services do not call.
+func TestProxyWithoutLogInit(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "mem",
+			opts: []Option{
+				WithListener(TCPListener(0)),
+				WithResource(Mem{Name: "nolog-mem"}),
+			},
+		},
+		{
+			name: "gen",
+			opts: []Option{
+				WithListener(TCPListener(0)),
+				WithResource(Gen{Pattern: res.GenCounter, Rate: 100}),
+			},
+		},
+		{
+			name: "hub",
+			opts: []Option{
+				WithListener(TCPListener(0)),
+				WithHub(server.HubAll),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := New(test.opts...)
+			if err != nil {
+				t.Fatalf("New() error - %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			runErr := make(chan error, 1)
+			go func() {
+				runErr <- p.Run(ctx)
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			select {
+			case err := <-runErr:
+				if err != context.Canceled {
+					t.Errorf("Run() error - %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Run() is not returned after cancel")
+			}
+
+			if err := p.Shutdown(context.Background()); err != nil {
+				t.Errorf("Shutdown() error - %v", err)
+			}
+		})
+	}
+}
+
+// blockRes is a write only resource which blocks writes until it is
+// unblocked.
+type blockRes struct {
+	info    string
+	unblock chan struct{}
+	closed  chan struct{}
+
+	lock    *sync.Mutex
+	isOpen  bool
+	written []byte
+}
+
+// newBlockRes allocates a blocked resource.
+func newBlockRes(info string) *blockRes {
+	return &blockRes{
+		info:    info,
+		unblock: make(chan struct{}),
+		closed:  make(chan struct{}),
+		lock:    &sync.Mutex{},
+		isOpen:  false,
+	}
+}
+
+func (r *blockRes) GetInfo() *string { return &r.info }
+func (r *blockRes) IsRable() bool    { return false }
+func (r *blockRes) IsWable() bool    { return true }
+
+func (r *blockRes) Open() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.isOpen = true
+	return nil
+}
+
+func (r *blockRes) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.isOpen {
+		return res.ErrALC
+	}
+	r.isOpen = false
+	close(r.closed)
+	return nil
+}
+
+func (r *blockRes) IsOpen() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.isOpen
+}
+
+func (r *blockRes) Read(b []byte) (n int, err error) {
+	<-r.closed
+	return 0, io.EOF
+}
+
+func (r *blockRes) Write(b []byte) (n int, err error) {
+	select {
+	case <-r.unblock:
+	case <-r.closed:
+		return 0, io.ErrClosedPipe
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.written = append(r.written, b...)
+	return len(b), nil
+}
+
+// getWritten returns data written to the resource.
+func (r *blockRes) getWritten() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return string(r.written)
+}
+
+// runProxy runs the proxy, and returns the channel of the error of Run.
+// The proxy is shut down at the end of the test.
+func runProxy(t *testing.T, p *Proxy) chan error {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- p.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		p.Shutdown(context.Background())
+	})
+	return runErr
+}
+
+// TestRunNoRes checks Run returns server.ErrNoRes without server resources
+// except in hub mode.
+func TestRunNoRes(t *testing.T) {
+	p, err := New(WithListener(TCPListener(0)))
+	if err != nil {
+		t.Fatalf("New() error - %v", err)
+	}
+	runErr := runProxy(t, p)
+
+	select {
+	case err := <-runErr:
+		if err != server.ErrNoRes {
+			t.Errorf("Run() error - %v, want %v", err, server.ErrNoRes)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run() is not returned without server resources")
+	}
+}
+
+// TestRunResClosed checks Run returns nil once all server resources are
+// closed and removed.
+func TestRunResClosed(t *testing.T) {
+	p, err := New(
+		WithListener(TCPListener(0)),
+		WithRetryInterval(0),
+		WithResource(Gen{Pattern: res.GenCounter, Rate: 100, Count: 3}),
+	)
+	if err != nil {
+		t.Fatalf("New() error - %v", err)
+	}
+	runErr := runProxy(t, p)
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run() error - %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run() is not returned after server resources are closed")
+	}
+}
+
+// TestShutdownDrain checks Shutdown waits pending writes of clients to
+// server resources before closing them. The client listener is a UNIX
+// domain socket whose path has ':', which is not a listener option.
+func TestShutdownDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sbps:drain.sock")
+	r := newBlockRes("BLOCK:drain")
+	p, err := New(
+		WithListener(UnixListener(path)),
+		WithResource(Raw{Res: r}),
+	)
+	if err != nil {
+		t.Fatalf("New() error - %v", err)
+	}
+	runProxy(t, p)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial() error - %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("a\n"))
+
+	// Wait until the write of the client is blocked
+	deadline := time.Now().Add(time.Second)
+	for p.sResHs[0].GetPending() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Write of the client is not pending")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- p.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown() is returned with a pending write - %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(r.unblock)
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Errorf("Shutdown() error - %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Shutdown() is not returned after the pending write")
+	}
+	if got := r.getWritten(); got != "a\n" {
+		t.Errorf("Written data is %q, want %q", got, "a\n")
+	}
+	if r.IsOpen() {
+		t.Errorf("Server resource is open after Shutdown()")
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"time"
+)
+
+// HealthTimeout is the timeout of a goroutine to respond a health check.
+const HealthTimeout = 2 * time.Second
+
+// Health represents liveness of goroutines of a server.
+type Health struct {
+	Live   bool `json:"live"`
+	Main   bool `json:"main"`
+	Listen bool `json:"listen"`
+	Retry  bool `json:"retry"`
+}
+
+// Readiness represents readiness of a server.
+type Readiness struct {
+	Ready   bool `json:"ready"`
+	Open    int  `json:"open"`
+	MinOpen int  `json:"minOpen"`
+}
+
+// SetMinOpen sets the minimum number of open server resources for
+// readiness. If it is not set, the minimum is 0 in hub mode and 1
+// otherwise.
+func (s *Server) SetMinOpen(minOpen int) error {
+	if minOpen < 0 {
+		return errors.New("Wrong minimum number of open server resources")
+	}
+	s.minOpen = minOpen
+	return nil
+}
+
+// getMinOpen returns the minimum number of open server resources for
+// readiness.
+func (s *Server) getMinOpen() int {
+	if s.minOpen >= 0 {
+		return s.minOpen
+	}
+	if s.isHub() {
+		return 0
+	}
+	return 1
+}
+
+// ping sends a ping to a goroutine and waits the response.
+func ping(pings chan chan struct{}) bool {
+	timer := time.NewTimer(HealthTimeout)
+	defer timer.Stop()
+
+	pong := make(chan struct{})
+	select {
+	case pings <- pong:
+	case <-timer.C:
+		return false
+	}
+
+	select {
+	case <-pong:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// GetHealth checks the main, listen and retry goroutines are responsive.
+// The retry goroutine is regarded as live if the retry interval is not set.
+func (s *Server) GetHealth() *Health {
+	s.isRunLock.Lock()
+	isRun := s.isRun
+	s.isRunLock.Unlock()
+
+	health := &Health{}
+	if !isRun {
+		return health
+	}
+
+	health.Main = ping(s.mPing)
+	health.Listen = ping(s.lPing)
+	health.Retry = s.sResInterval <= 0 || ping(s.rPing)
+	health.Live = health.Main && health.Listen && health.Retry
+	return health
+}
+
+// GetReadiness checks the number of open server resources is larger than
+// or equal to the minimum.
+func (s *Server) GetReadiness() *Readiness {
+	s.resHLock.Lock()
+	open := len(s.sResHs) - len(s.sResClosedHs)
+	s.resHLock.Unlock()
+
+	minOpen := s.getMinOpen()
+	return &Readiness{
+		Ready:   open >= minOpen,
+		Open:    open,
+		MinOpen: minOpen,
+	}
+}
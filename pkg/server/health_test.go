@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+// TestGetHealth checks the listen goroutine responds to pings while
+// accepting clients, and is not live after the listener is closed.
+func TestGetHealth(t *testing.T) {
+	s := newTestServer(t, HubAll)
+	if health := s.GetHealth(); health.Live {
+		t.Fatalf("GetHealth() of the stopped server is %+v, want not live", health)
+	}
+
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run() error - %v", err)
+	}
+	want := Health{Live: true, Main: true, Listen: true, Retry: true}
+	if health := s.GetHealth(); *health != want {
+		t.Fatalf("GetHealth() is %+v, want %+v", *health, want)
+	}
+
+	// Clients are accepted after pings
+	conn, err := net.Dial("tcp", s.ln.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error - %v", err)
+	}
+	waitCResHs(t, s, 1)
+	if health := s.GetHealth(); *health != want {
+		t.Fatalf("GetHealth() with a client is %+v, want %+v", *health, want)
+	}
+	conn.Close()
+	waitCResHs(t, s, 0)
+
+	// The listen goroutine stops after the listener is closed
+	s.closeListener()
+	want = Health{Live: false, Main: true, Listen: false, Retry: true}
+	if health := s.GetHealth(); *health != want {
+		t.Fatalf("GetHealth() without the listener is %+v, want %+v", *health, want)
+	}
+}
+
+// TestGetReadiness checks the default minimum of open server resources
+// depends on the hub mode.
+func TestGetReadiness(t *testing.T) {
+	tests := []struct {
+		name    string
+		hub     string
+		minOpen int // -1 means the default
+		open    bool
+		want    Readiness
+	}{
+		{name: "default", hub: HubNone, minOpen: -1,
+			want: Readiness{Ready: false, Open: 0, MinOpen: 1}},
+		{name: "default-open", hub: HubNone, minOpen: -1, open: true,
+			want: Readiness{Ready: true, Open: 1, MinOpen: 1}},
+		{name: "hub", hub: HubAll, minOpen: -1,
+			want: Readiness{Ready: true, Open: 0, MinOpen: 0}},
+		{name: "hub-set", hub: HubOthers, minOpen: 1,
+			want: Readiness{Ready: false, Open: 0, MinOpen: 1}},
+		{name: "set", hub: HubNone, minOpen: 0,
+			want: Readiness{Ready: true, Open: 0, MinOpen: 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, test.hub)
+			if test.minOpen >= 0 {
+				if err := s.SetMinOpen(test.minOpen); err != nil {
+					t.Fatalf("SetMinOpen() error - %v", err)
+				}
+			}
+			if test.open {
+				name := t.Name()
+				r := res.NewMem(&name, (1<<res.ModeR)|(1<<res.ModeW))
+				if err := r.Open(); err != nil {
+					t.Fatalf("Open() error - %v", err)
+				}
+				defer r.Close()
+				s.AddSResHandler(res.NewHandler(r, s.GetSResHNoti()))
+			}
+
+			if got := s.GetReadiness(); *got != test.want {
+				t.Errorf("GetReadiness() is %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+
+	s := newTestServer(t, HubNone)
+	if err := s.SetMinOpen(-1); err == nil {
+		t.Errorf("SetMinOpen(-1) succeeded")
+	}
+}
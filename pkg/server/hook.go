@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hook events.
+const (
+	EventResOpen       = "RES_OPEN"
+	EventResClose      = "RES_CLOSE"
+	EventResReconnect  = "RES_RECONNECT"
+	EventResExhausted  = "RES_RETRY_EXHAUSTED"
+	EventClientConnect = "CLIENT_CONNECT"
+	EventClientDisconn = "CLIENT_DISCONNECT"
+	EventAll           = "ALL"
+)
+
+// Constants for hooks.
+const (
+	HookTypeExec    = "EXEC"
+	HookTypeWebhook = "WEBHOOK"
+
+	HookTimeout         = 10 * time.Second
+	HookEnvPrefix       = "SBPS_"
+	HookEventsSeparator = "|"
+)
+
+// ErrHook is error instance for wrong hook option.
+var ErrHook = errors.New("Wrong hook option")
+
+// Event represents a state change of a server.
+type Event struct {
+	Type    string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Res     string    `json:"resource,omitempty"`
+	Client  string    `json:"client,omitempty"`
+	Retries int       `json:"retries,omitempty"`
+}
+
+// Hook executes a local command or posts JSON to a URL on events.
+type Hook struct {
+	events map[string]struct{}
+	hType  string
+	target string
+}
+
+// NewHook allocates and initializes a hook instance from a hook option
+// (EVENT[|EVENT...]:EXEC:command [args...], EVENT[|EVENT...]:WEBHOOK:url).
+// ALL event means all events.
+func NewHook(opt *string) (*Hook, error) {
+	split := strings.SplitN(*opt, ":", 3)
+	if len(split) != 3 || split[2] == "" {
+		return nil, ErrHook
+	}
+
+	h := &Hook{
+		events: make(map[string]struct{}),
+		hType:  split[1],
+		target: split[2],
+	}
+
+	for _, event := range strings.Split(split[0], HookEventsSeparator) {
+		switch event {
+		case EventResOpen, EventResClose, EventResReconnect, EventResExhausted,
+			EventClientConnect, EventClientDisconn:
+			h.events[event] = struct{}{}
+		case EventAll:
+			h.events = nil
+		default:
+			return nil, ErrHook
+		}
+		if h.events == nil {
+			break
+		}
+	}
+
+	switch h.hType {
+	case HookTypeExec:
+		if len(strings.Fields(h.target)) == 0 {
+			return nil, ErrHook
+		}
+	case HookTypeWebhook:
+		if !strings.HasPrefix(h.target, "http://") && !strings.HasPrefix(h.target, "https://") {
+			return nil, ErrHook
+		}
+	default:
+		return nil, ErrHook
+	}
+	return h, nil
+}
+
+// isEvent checks the hook is fired on the event.
+func (h *Hook) isEvent(event string) bool {
+	if h.events == nil {
+		return true
+	}
+	_, exist := h.events[event]
+	return exist
+}
+
+// run executes the hook for the event.
+func (h *Hook) run(e *Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), HookTimeout)
+	defer cancel()
+
+	switch h.hType {
+	case HookTypeExec:
+		// Pass the event by environment variables
+		args := strings.Fields(h.target)
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = append(os.Environ(),
+			HookEnvPrefix+"EVENT="+e.Type,
+			HookEnvPrefix+"TIME="+e.Time.Format(time.RFC3339Nano),
+			HookEnvPrefix+"RESOURCE="+e.Res,
+			HookEnvPrefix+"CLIENT="+e.Client,
+			HookEnvPrefix+"RETRIES="+strconv.Itoa(e.Retries))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s - %s", err.Error(), strings.TrimSpace(string(out)))
+		}
+		return nil
+
+	case HookTypeWebhook:
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, h.target, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return errors.New("Wrong status - " + resp.Status)
+		}
+		return nil
+	}
+	return ErrHook
+}
+
+// SetMaxRetry sets the maximum number of reopen retries of a closed server
+// resource. 0 means unlimited retries.
+func (s *Server) SetMaxRetry(maxRetry int) error {
+	if maxRetry < 0 {
+		return errors.New("Wrong maximum number of retries")
+	}
+	s.sResMaxRetry = maxRetry
+	return nil
+}
+
+// AddHook appends a hook of the server.
+func (s *Server) AddHook(h *Hook) {
+	s.hooks = append(s.hooks, h)
+}
+
+// fire runs hooks of the event in background.
+func (s *Server) fire(e *Event) {
+	e.Time = time.Now()
+	for _, h := range s.hooks {
+		if !h.isEvent(e.Type) {
+			continue
+		}
+
+		s.hooksWg.Add(1)
+		go func(h *Hook) {
+			defer s.hooksWg.Done()
+			if err := h.run(e); err != nil {
+				sLog.WithRes(e.Res).WithClient(e.Client).WithErr(err).Errorf(
+					"Run the hook failed - %s - %s - %s", e.Type, h.target, err.Error())
+			}
+		}(h)
+	}
+}
+
+// WaitHooks waits running hooks. Hooks are finished in HookTimeout.
+func (s *Server) WaitHooks() {
+	s.hooksWg.Wait()
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestNewHook checks hook options and events of hooks.
+func TestNewHook(t *testing.T) {
+	tests := []struct {
+		opt    string
+		err    bool
+		events []string
+		others []string
+	}{
+		{opt: "RES_OPEN:EXEC:true", events: []string{EventResOpen},
+			others: []string{EventResClose, EventClientConnect}},
+		{opt: "RES_CLOSE|CLIENT_CONNECT:WEBHOOK:http://127.0.0.1/hook",
+			events: []string{EventResClose, EventClientConnect},
+			others: []string{EventResOpen, EventClientDisconn}},
+		{opt: "RES_OPEN|ALL:EXEC:true", events: []string{EventResOpen, EventResExhausted,
+			EventClientDisconn}},
+		{opt: "RES_OPEN:EXEC:", err: true},
+		{opt: "RES_OPEN:EXEC: ", err: true},
+		{opt: "RES_OPEN:EXEC", err: true},
+		{opt: "UNKNOWN:EXEC:true", err: true},
+		{opt: "RES_OPEN:WEBHOOK:ftp://127.0.0.1", err: true},
+		{opt: "RES_OPEN:UNKNOWN:true", err: true},
+	}
+
+	for _, test := range tests {
+		h, err := NewHook(&test.opt)
+		if test.err {
+			if err == nil {
+				t.Errorf("NewHook(%q) succeeded, want error", test.opt)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewHook(%q) error - %v", test.opt, err)
+			continue
+		}
+		for _, event := range test.events {
+			if !h.isEvent(event) {
+				t.Errorf("Hook %q is not fired on %s", test.opt, event)
+			}
+		}
+		for _, event := range test.others {
+			if h.isEvent(event) {
+				t.Errorf("Hook %q is fired on %s", test.opt, event)
+			}
+		}
+	}
+}
+
+// TestHookExec checks an EXEC hook gets the event by environment
+// variables.
+func TestHookExec(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hook.sh")
+	out := filepath.Join(dir, "out")
+	err := os.WriteFile(script, []byte(
+		`echo "$SBPS_EVENT $SBPS_RESOURCE $SBPS_CLIENT $SBPS_RETRIES" > "$1"`), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile() error - %v", err)
+	}
+
+	opt := "ALL:EXEC:sh " + script + " " + out
+	h, err := NewHook(&opt)
+	if err != nil {
+		t.Fatalf("NewHook() error - %v", err)
+	}
+	if err := h.run(&Event{Type: EventResReconnect, Res: "MEM:a", Retries: 3}); err != nil {
+		t.Fatalf("run() error - %v", err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile() error - %v", err)
+	}
+	if want := EventResReconnect + " MEM:a  3\n"; string(b) != want {
+		t.Errorf("Hook output %q, want %q", b, want)
+	}
+
+	// Failed commands return errors
+	opt = "ALL:EXEC:false"
+	h, _ = NewHook(&opt)
+	if err := h.run(&Event{Type: EventResOpen}); err == nil {
+		t.Errorf("run() of a failed command succeeded")
+	}
+}
+
+// TestHookWebhook checks a WEBHOOK hook posts events of the hook, and
+// errors of responses are returned.
+func TestHookWebhook(t *testing.T) {
+	lock := &sync.Mutex{}
+	var events []Event
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := Event{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("Decode() of the event error - %v", err)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type is %q, want application/json", ct)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, e)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	opt := "CLIENT_CONNECT|CLIENT_DISCONNECT:WEBHOOK:" + srv.URL
+	h, err := NewHook(&opt)
+	if err != nil {
+		t.Fatalf("NewHook() error - %v", err)
+	}
+	s := newTestServer(t, HubNone)
+	s.AddHook(h)
+
+	s.fire(&Event{Type: EventResOpen, Res: "MEM:a"})
+	s.fire(&Event{Type: EventClientConnect, Client: "CONN:TCP:127.0.0.1:10000"})
+	s.WaitHooks()
+
+	lock.Lock()
+	if len(events) != 1 || events[0].Type != EventClientConnect ||
+		events[0].Client != "CONN:TCP:127.0.0.1:10000" || events[0].Time.IsZero() {
+		t.Errorf("Posted events %+v, want a CLIENT_CONNECT event", events)
+	}
+	status = http.StatusInternalServerError
+	lock.Unlock()
+
+	if err := h.run(&Event{Type: EventClientDisconn}); err == nil {
+		t.Errorf("run() with an error response succeeded")
+	}
+}
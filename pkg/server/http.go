@@ -0,0 +1,265 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ssup2/sbps/pkg/log"
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+// HTTP paths and stream formats.
+const (
+	PathStream   = "/stream"
+	PathWrite    = "/write"
+	PathStatus   = "/status"
+	PathLogLevel = "/loglevel"
+	PathHealthz  = "/healthz"
+	PathReadyz   = "/readyz"
+
+	FormatSSE = "sse"
+	FormatRaw = "raw"
+)
+
+// HTTP serves HTTP endpoints of a server for clients which cannot hold
+// raw sockets. HTTP clients are registered as client resource handlers.
+type HTTP struct {
+	s   *Server
+	ln  *Listener
+	mux *http.ServeMux
+	srv *http.Server
+}
+
+// NewHTTP allocates and initialize a HTTP instance for the server.
+func (s *Server) NewHTTP(optHTTP *string) (*HTTP, error) {
+	ln, err := ParseListener(optHTTP)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewHTTPWithListener(ln), nil
+}
+
+// NewHTTPWithListener allocates and initialize a HTTP instance for the
+// server with the listener of HTTP clients.
+func (s *Server) NewHTTPWithListener(ln *Listener) *HTTP {
+	lnLog.Infof("Allocate a HTTP server")
+
+	h := &HTTP{
+		s:   s,
+		ln:  ln,
+		mux: http.NewServeMux(),
+	}
+	h.srv = &http.Server{Handler: h.mux}
+
+	h.mux.HandleFunc(PathStream, h.handleStream)
+	h.mux.HandleFunc(PathStream+"/", h.handleStream)
+	h.mux.HandleFunc(PathWrite, h.handleWrite)
+	h.mux.HandleFunc(PathWrite+"/", h.handleWrite)
+	h.mux.HandleFunc(PathStatus, h.handleStatus)
+	h.mux.HandleFunc(PathLogLevel, h.handleLogLevel)
+	h.mux.HandleFunc(PathHealthz, h.handleHealthz)
+	h.mux.HandleFunc(PathReadyz, h.handleReadyz)
+	return h
+}
+
+// Close closes the HTTP server and all HTTP clients.
+func (h *HTTP) Close() {
+	h.srv.Close()
+}
+
+// Run starts a HTTP serve goroutine.
+func (h *HTTP) Run() {
+	lnLog.Infof("Run the HTTP server")
+
+	go func() {
+		err := h.srv.Serve(h.ln.ln)
+		if err != nil && err != http.ErrServerClosed {
+			lnLog.WithErr(err).Errorf("Serve HTTP failed - %s", err.Error())
+		}
+	}()
+}
+
+// getTarget gets the server resource info from the request path.
+// nil target means all server resources.
+func (h *HTTP) getTarget(w http.ResponseWriter, req *http.Request,
+	path string) (*string, bool) {
+	info := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, path), "/")
+	if info == "" {
+		return nil, true
+	}
+
+	if !h.s.HasSRes(&info) {
+		http.Error(w, "Wrong server resource", http.StatusNotFound)
+		return nil, false
+	}
+	return &info, true
+}
+
+// handleStream streams the broadcast as SSE or chunked binary.
+func (h *HTTP) handleStream(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, ok := h.getTarget(w, req, PathStream)
+	if !ok {
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	isSSE := strings.Compare(format, FormatSSE) == 0 ||
+		(format == "" && strings.Contains(req.Header.Get("Accept"), "text/event-stream"))
+	if !isSSE && format != "" && strings.Compare(format, FormatRaw) != 0 {
+		http.Error(w, "Wrong format", http.StatusBadRequest)
+		return
+	}
+
+	r, err := res.NewHTTPStream(w, req, target, isSSE)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if isSSE {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	lnLog.WithClient(*r.GetInfo()).Infof("Accept the new HTTP client - %s", *r.GetInfo())
+	cResH := res.NewHandler(r, h.s.cResHNoti)
+	h.ln.SetCResOpts(cResH)
+	h.s.AddCResHandler(cResH)
+	cResH.Run()
+
+	// Block until the client or the resource is closed
+	<-r.Done()
+}
+
+// handleWrite writes the request body to server resources.
+func (h *HTTP) handleWrite(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, ok := h.getTarget(w, req, PathWrite)
+	if !ok {
+		return
+	}
+
+	r := res.NewHTTPWrite(w, req, target)
+
+	lnLog.WithClient(*r.GetInfo()).Infof("Accept the new HTTP client - %s", *r.GetInfo())
+	cResH := res.NewHandler(r, h.s.cResHNoti)
+	h.ln.SetCResOpts(cResH)
+	h.s.AddCResHandler(cResH)
+	cResH.Run()
+
+	// Block until the whole body is written
+	<-r.Done()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStatus returns status of the server as JSON.
+func (h *HTTP) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(h.s.GetStatus())
+	if err != nil {
+		lnLog.WithErr(err).Errorf("Encode status failed - %s", err.Error())
+	}
+}
+
+// handleLogLevel gets or changes log levels. PUT sets the global log level,
+// or the override of the target which is a component or info of a resource
+// or a client. DELETE deletes the override of the target.
+func (h *HTTP) handleLogLevel(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	target := query.Get("target")
+	level := query.Get("level")
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var err error
+		if target == "" {
+			err = log.SetLevel(&level)
+		} else {
+			err = log.SetOverride(&target, &level)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lnLog.Infof("Set log level - %s - %s", target, level)
+	case http.MethodDelete:
+		if target == "" {
+			http.Error(w, "Wrong target", http.StatusBadRequest)
+			return
+		}
+		log.DeleteOverride(&target)
+		lnLog.Infof("Delete log level override - %s", target)
+	default:
+		http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(log.GetLevelStatus())
+	if err != nil {
+		lnLog.WithErr(err).Errorf("Encode log level failed - %s", err.Error())
+	}
+}
+
+// handleHealthz returns liveness of the server. It fails with 503 if
+// goroutines of the server are not responsive.
+func (h *HTTP) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	health := h.s.GetHealth()
+	h.writeProbe(w, health, health.Live)
+}
+
+// handleReadyz returns readiness of the server. It fails with 503 if
+// fewer server resources than the minimum are open.
+func (h *HTTP) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Wrong method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	readiness := h.s.GetReadiness()
+	h.writeProbe(w, readiness, readiness.Ready)
+}
+
+// writeProbe writes the result of a probe as JSON.
+func (h *HTTP) writeProbe(w http.ResponseWriter, result interface{}, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		lnLog.WithErr(err).Errorf("Encode probe failed - %s", err.Error())
+	}
+}
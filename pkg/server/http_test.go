@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/log"
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+func init() {
+	level := log.OptCrit
+	format := log.OptText
+	log.Init(nil, &level, &format, nil, nil)
+}
+
+// testTimeout is the timeout to wait events in tests.
+const testTimeout = 2 * time.Second
+
+// runTestHTTP runs a server with a unix socket server resource and a HTTP
+// server of the server. It returns the URL of the HTTP server, the server,
+// the info of the server resource and the device side connection of the
+// resource.
+func runTestHTTP(t *testing.T) (string, *Server, string, net.Conn) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "dev.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen() error - %v", err)
+	}
+	defer ln.Close()
+
+	r := res.NewUnix(&path, (1<<res.ModeR)|(1<<res.ModeW))
+	if err := r.Open(); err != nil {
+		t.Fatalf("Open() error - %v", err)
+	}
+	dev, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error - %v", err)
+	}
+
+	opt := "TCP:0"
+	s, err := New(&opt, 0)
+	if err != nil {
+		t.Fatalf("New() error - %v", err)
+	}
+	sResH := res.NewHandler(r, s.GetSResHNoti())
+	s.AddSResHandler(sResH)
+	sResH.Run()
+	s.Run()
+	t.Cleanup(func() {
+		// Stop the server first not to exit when the resource is closed
+		s.Stop()
+		s.ln.ln.Close()
+		dev.Close()
+	})
+
+	h, err := s.NewHTTP(&opt)
+	if err != nil {
+		t.Fatalf("NewHTTP() error - %v", err)
+	}
+	h.Run()
+	t.Cleanup(h.Close)
+	return "http://" + h.ln.ln.Addr().String(), s, *r.GetInfo(), dev
+}
+
+// waitCResHs waits until the server has the number of clients.
+func waitCResHs(t *testing.T, s *Server, clients int) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		s.resHLock.Lock()
+		n := len(s.cResHs)
+		s.resHLock.Unlock()
+		if n == clients {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server has %d clients, want %d", n, clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestHTTPStream checks data of server resources is streamed as SSE events
+// or raw chunks.
+func TestHTTPStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		resource bool
+		want     string
+	}{
+		{name: "raw", path: "?format=raw", want: "a\nb\n"},
+		{name: "sse", path: "?format=sse", want: "data: a\ndata: b\n\n"},
+		{name: "accept", path: "", accept: "text/event-stream",
+			want: "data: a\ndata: b\n\n"},
+		{name: "resource", path: "", resource: true, want: "a\nb\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url, s, info, dev := runTestHTTP(t)
+
+			path := PathStream + test.path
+			if test.resource {
+				path = PathStream + "/" + info
+			}
+			req, _ := http.NewRequest(http.MethodGet, url+path, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET error - %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET status is %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			waitCResHs(t, s, 1)
+
+			dev.Write([]byte("a\nb\n"))
+			got := make([]byte, len(test.want))
+			done := make(chan error)
+			go func() {
+				_, err := io.ReadFull(resp.Body, got)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("Read stream error - %v", err)
+				}
+			case <-time.After(testTimeout):
+				t.Fatalf("Read stream timeout")
+			}
+			if string(got) != test.want {
+				t.Errorf("Stream is %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestHTTPWrite checks request bodies are written to server resources.
+func TestHTTPWrite(t *testing.T) {
+	url, _, info, dev := runTestHTTP(t)
+
+	paths := []string{PathWrite, PathWrite + "/" + info}
+	reader := bufio.NewReader(dev)
+	for _, path := range paths {
+		resp, err := http.Post(url+path, "text/plain", strings.NewReader("a\n"))
+		if err != nil {
+			t.Fatalf("POST %s error - %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("POST %s status is %d, want %d", path, resp.StatusCode,
+				http.StatusNoContent)
+		}
+
+		dev.SetReadDeadline(time.Now().Add(testTimeout))
+		line, err := reader.ReadString('\n')
+		if err != nil || line != "a\n" {
+			t.Fatalf("Device read %q, %v, want %q", line, err, "a\n")
+		}
+	}
+}
+
+// TestHTTPErrors checks wrong methods, resources and formats of requests.
+func TestHTTPErrors(t *testing.T) {
+	url, _, _, _ := runTestHTTP(t)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{method: http.MethodPost, path: PathStream, status: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: PathWrite, status: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: PathStream + "/UNIX:unknown", status: http.StatusNotFound},
+		{method: http.MethodPost, path: PathWrite + "/UNIX:unknown", status: http.StatusNotFound},
+		{method: http.MethodGet, path: PathStream + "?format=xml", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, url+test.path, strings.NewReader(""))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("%s %s error - %v", test.method, test.path, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s status is %d, want %d", test.method, test.path,
+				resp.StatusCode, test.status)
+		}
+	}
+}
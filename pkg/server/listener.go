@@ -4,6 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/res"
 )
 
 // Listener types
@@ -13,12 +19,37 @@ const (
 	TypeUnix = "UNIX"
 )
 
+// Listener options
+const (
+	LnOptRTransform = "rtransform"
+	LnOptWTransform = "wtransform"
+	LnOptRate       = "rate"
+	LnOptFrameRate  = "frate"
+	LnOptRateMode   = "ratemode"
+	LnOptWTimeout   = "wtimeout"
+	LnOptWQueue     = "wqueue"
+	LnOptWPolicy    = "wpolicy"
+	LnOptRecord     = "record"
+)
+
 // Listener represents listener information
 type Listener struct {
 	ln net.Listener
 
 	lType string
 	lOpt  string
+
+	rTrans res.Chain
+	wTrans res.Chain
+
+	rate      float64
+	frameRate float64
+	rateMode  string
+
+	wTimeout time.Duration
+	wQueue   int
+	wPolicy  string
+	recorder *res.Recorder
 }
 
 // NewListener allocates and initialize a listener instance
@@ -42,3 +73,152 @@ func NewListener(lType *string, lOpt *string) (*Listener, error) {
 
 	return &Listener{ln: ln, lType: *lType, lOpt: *lOpt}, nil
 }
+
+// ParseListener allocates and initialize a listener instance from
+// a listener option (TYPE:opt[?key=value&...]).
+func ParseListener(opt *string) (*Listener, error) {
+	loc := *opt
+	query := ""
+	if i := strings.Index(loc, "?"); i >= 0 {
+		query = loc[i+1:]
+		loc = loc[:i]
+	}
+
+	split := strings.Split(loc, ":")
+	if len(split) != 2 {
+		return nil, errors.New("Wrong listener options")
+	}
+
+	opts, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return NewListenerOpts(&split[0], &split[1], opts)
+}
+
+// NewListenerOpts allocates and initialize a listener instance with
+// listener options applied to client resource handlers.
+func NewListenerOpts(lType *string, lOpt *string, opts url.Values) (*Listener, error) {
+	ln, err := NewListener(lType, lOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ln.setOpts(opts)
+	if err != nil {
+		ln.ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// setOpts sets listener options applied to client resource handlers.
+func (ln *Listener) setOpts(opts url.Values) error {
+	var err error
+
+	for key := range opts {
+		switch key {
+		case LnOptRTransform, LnOptWTransform, LnOptRate, LnOptFrameRate, LnOptRateMode,
+			LnOptWTimeout, LnOptWQueue, LnOptWPolicy, LnOptRecord:
+		default:
+			return errors.New("Wrong listener option - " + key)
+		}
+	}
+
+	ln.rTrans, err = res.NewChain(opts[LnOptRTransform])
+	if err != nil {
+		return err
+	}
+	ln.wTrans, err = res.NewChain(opts[LnOptWTransform])
+	if err != nil {
+		return err
+	}
+
+	// Rate limit of client writes
+	ln.rateMode = res.LimitDelay
+	if opt := opts.Get(LnOptRateMode); opt != "" {
+		ln.rateMode = opt
+	}
+	if opt := opts.Get(LnOptRate); opt != "" {
+		ln.rate, err = strconv.ParseFloat(opt, 64)
+		if err != nil {
+			return err
+		}
+	}
+	if opt := opts.Get(LnOptFrameRate); opt != "" {
+		ln.frameRate, err = strconv.ParseFloat(opt, 64)
+		if err != nil {
+			return err
+		}
+	}
+	if ln.rate > 0 || ln.frameRate > 0 {
+		_, err = res.NewLimiter(&ln.rateMode, ln.rate, ln.frameRate)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write deadline of writes to clients
+	if opt := opts.Get(LnOptWTimeout); opt != "" {
+		ln.wTimeout, err = time.ParseDuration(opt)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write queue of clients
+	if opt := opts.Get(LnOptWQueue); opt != "" {
+		ln.wQueue, err = strconv.Atoi(opt)
+		if err != nil {
+			return err
+		}
+	}
+	if opt := opts.Get(LnOptWPolicy); opt != "" {
+		ln.wPolicy = opt
+	}
+	if ln.wQueue < 0 || (ln.wPolicy != "" && ln.wPolicy != res.WriteDrop &&
+		ln.wPolicy != res.WriteDisconnect) {
+		return res.ErrWQueue
+	}
+
+	// Recording of clients
+	if opt := opts.Get(LnOptRecord); opt != "" {
+		ln.recorder, err = res.GetRecorder(&opt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCResOpts sets listener options to a client resource handler.
+func (ln *Listener) SetCResOpts(cResH *res.Handler) {
+	if ln.rTrans != nil {
+		cResH.SetRTransform(ln.rTrans)
+	}
+	if ln.wTrans != nil {
+		cResH.SetWTransform(ln.wTrans)
+	}
+
+	// Each client has its own limiter
+	if ln.rate > 0 || ln.frameRate > 0 {
+		l, _ := res.NewLimiter(&ln.rateMode, ln.rate, ln.frameRate)
+		cResH.SetLimiter(l)
+	}
+
+	if ln.wTimeout > 0 {
+		cResH.SetWriteTimeout(ln.wTimeout)
+	}
+	// Clients have no write queue unless it is set, and the default
+	// policy disconnects clients instead of dropping data
+	if ln.wQueue > 0 {
+		policy := ln.wPolicy
+		if policy == "" {
+			policy = res.WriteDisconnect
+		}
+		cResH.SetWriteQueue(ln.wQueue, &policy)
+	}
+	if ln.recorder != nil {
+		cResH.AddTap(ln.recorder)
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+// Monitor formats.
+const (
+	MonitorText = "TEXT"
+	MonitorJSON = "JSON"
+)
+
+// Monitor serves monitor clients which receive a copy of all traffic of
+// server resources. Data read from server resources and data written by
+// clients are annotated with direction and origin. Monitor clients never
+// write to server resources. Frames are queued to the write queue of each
+// monitor client, so slow monitor clients never slow down server resources.
+type Monitor struct {
+	ln     *Listener
+	format string
+
+	clientsLock *sync.Mutex
+	clients     map[*res.Handler]struct{}
+	closeNoti   chan *res.Handler
+	quit        chan struct{}
+	closeOnce   *sync.Once
+
+	drops int64
+}
+
+// NewMonitor allocates and initialize a monitor instance for the server.
+// It must be allocated before server resources are added.
+func (s *Server) NewMonitor(optMonitor *string, format *string) (*Monitor, error) {
+	ln, err := ParseListener(optMonitor)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewMonitorWithListener(ln, format)
+}
+
+// NewMonitorWithListener allocates and initialize a monitor instance for
+// the server with the listener of monitor clients. The listener is closed
+// on error.
+func (s *Server) NewMonitorWithListener(ln *Listener, format *string) (*Monitor, error) {
+	lnLog.Infof("Allocate a monitor")
+
+	switch *format {
+	case MonitorText, MonitorJSON:
+	default:
+		ln.ln.Close()
+		return nil, errors.New("Wrong monitor format")
+	}
+
+	// Records to monitor clients are always queued, and dropped when the
+	// queue is full by default, so monitor clients never slow down server
+	// resources
+	if ln.wQueue == 0 {
+		ln.wQueue = res.WriteQueueSize
+	}
+	if ln.wPolicy == "" {
+		ln.wPolicy = res.WriteDrop
+	}
+
+	m := &Monitor{
+		ln:     ln,
+		format: *format,
+
+		clientsLock: &sync.Mutex{},
+		clients:     make(map[*res.Handler]struct{}),
+		closeNoti:   make(chan *res.Handler),
+		quit:        make(chan struct{}),
+		closeOnce:   &sync.Once{},
+	}
+	s.monitor = m
+	return m, nil
+}
+
+// Close closes the monitor listener and all monitor clients.
+func (m *Monitor) Close() {
+	m.closeOnce.Do(func() {
+		m.ln.ln.Close()
+		close(m.quit)
+
+		m.clientsLock.Lock()
+		clients := m.clients
+		m.clients = make(map[*res.Handler]struct{})
+		m.clientsLock.Unlock()
+
+		for cResH := range clients {
+			cResH.Stop()
+			cResH.Close()
+		}
+	})
+}
+
+// GetDrops returns the number of frames which are not sent to monitor
+// clients because write queues of monitor clients are full.
+func (m *Monitor) GetDrops() int64 {
+	return atomic.LoadInt64(&m.drops)
+}
+
+// Run starts accept and remove goroutines of monitor clients.
+func (m *Monitor) Run() {
+	lnLog.Infof("Run the monitor")
+
+	// Accept goroutine
+	go func() {
+		for {
+			conn, err := m.ln.ln.Accept()
+			if err != nil {
+				lnLog.WithErr(err).Infof("Accept monitor client failed - %s", err.Error())
+				return
+			}
+
+			// Data from monitor clients is discarded because monitor
+			// clients are not linked to server resources
+			cResH := res.NewHandler(res.NewConn(&conn), m.closeNoti)
+			m.ln.SetCResOpts(cResH)
+			lnLog.WithClient(*cResH.GetRes().GetInfo()).Infof("Accept the new monitor client")
+
+			m.clientsLock.Lock()
+			m.clients[cResH] = struct{}{}
+			m.clientsLock.Unlock()
+			cResH.Run()
+		}
+	}()
+
+	// Remove goroutine
+	go func() {
+		for {
+			select {
+			case cResH := <-m.closeNoti:
+				lnLog.WithClient(*cResH.GetRes().GetInfo()).Infof("Remove the monitor client")
+
+				m.clientsLock.Lock()
+				delete(m.clients, cResH)
+				m.clientsLock.Unlock()
+			case <-m.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Tap sends a copy of data read from or written to a server resource to
+// all monitor clients. Frames are dropped for monitor clients whose write
+// queues are full.
+func (m *Monitor) Tap(dir string, h *res.Handler, src *res.Handler, b []byte) {
+	m.send(res.NewRecord(dir, h, src, b), false)
+}
+
+// clientTap is the tap of client resource handlers for monitor clients.
+// Data written to clients is a copy of data of server resources or other
+// clients, so only data read from clients is sent.
+type clientTap struct {
+	m *Monitor
+}
+
+// Tap sends a copy of data read from a client resource to all monitor
+// clients.
+func (t clientTap) Tap(dir string, h *res.Handler, src *res.Handler, b []byte) {
+	if dir != res.RecordRead {
+		return
+	}
+	t.m.send(res.NewRecord(dir, h, src, b), true)
+}
+
+// send sends a record to all monitor clients. client means the record is
+// data read from a client resource.
+func (m *Monitor) send(rec *res.Record, client bool) {
+	m.clientsLock.Lock()
+	if len(m.clients) == 0 {
+		m.clientsLock.Unlock()
+		return
+	}
+	clients := make([]*res.Handler, 0, len(m.clients))
+	for cResH := range m.clients {
+		clients = append(clients, cResH)
+	}
+	m.clientsLock.Unlock()
+
+	// Write queues hold copies of the frame
+	frame := m.getFrame(rec, client)
+	if frame == nil {
+		return
+	}
+
+	for _, cResH := range clients {
+		if n, _ := cResH.Write(frame); n < len(frame) {
+			atomic.AddInt64(&m.drops, 1)
+		}
+	}
+}
+
+// getFrame formats a record. In text format, a record is a line of time,
+// direction, origin, destination and quoted data.
+func (m *Monitor) getFrame(rec *res.Record, client bool) []byte {
+	if m.format == MonitorJSON {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return nil
+		}
+		return append(b, '\n')
+	}
+
+	from, to := rec.Res, "clients"
+	if client {
+		to = "sbps"
+	} else if rec.Dir == res.RecordWrite {
+		from, to = rec.Src, rec.Res
+		if from == "" {
+			from = "sbps"
+		}
+	}
+	return []byte(fmt.Sprintf("%s %s %s -> %s %s\n", rec.Time.Format(time.RFC3339Nano),
+		rec.Dir, from, to, strconv.Quote(string(rec.Data))))
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+// newTestMonitor runs a monitor of the listener options on a free TCP
+// port, and returns the monitor with the address of the listener.
+func newTestMonitor(t *testing.T, query string) (*Monitor, string) {
+	t.Helper()
+
+	opt := "TCP:0" + query
+	format := MonitorText
+	m, err := (&Server{}).NewMonitor(&opt, &format)
+	if err != nil {
+		t.Fatalf("NewMonitor() error - %v", err)
+	}
+	m.Run()
+	t.Cleanup(m.Close)
+	return m, m.ln.ln.Addr().String()
+}
+
+// dialMonitor dials the monitor and waits until the monitor has the number
+// of clients.
+func dialMonitor(t *testing.T, m *Monitor, addr string, clients int) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error - %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitClients(t, m, clients)
+	return conn
+}
+
+// waitClients waits until the monitor has the number of clients.
+func waitClients(t *testing.T, m *Monitor, clients int) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		m.clientsLock.Lock()
+		n := len(m.clients)
+		m.clientsLock.Unlock()
+		if n == clients {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Monitor has %d clients, want %d", n, clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newTestSrc returns a handler of a memory resource which is the source of
+// monitored data.
+func newTestSrc(name string) *res.Handler {
+	return res.NewHandler(res.NewMem(&name, (1<<res.ModeR)|(1<<res.ModeW)), nil)
+}
+
+// TestMonitorTap checks frames are sent to monitor clients and closed
+// monitor clients are removed.
+func TestMonitorTap(t *testing.T) {
+	m, addr := newTestMonitor(t, "")
+	conn := dialMonitor(t, m, addr, 1)
+	h := newTestSrc("src")
+	client := newTestSrc("client")
+
+	tests := []struct {
+		dir  string
+		src  *res.Handler
+		want string
+	}{
+		{dir: res.RecordRead, src: nil, want: ` R MEM:src -> clients "a\n"`},
+		{dir: res.RecordWrite, src: client, want: ` W MEM:client -> MEM:src "a\n"`},
+		{dir: res.RecordWrite, src: nil, want: ` W sbps -> MEM:src "a\n"`},
+	}
+
+	reader := bufio.NewReader(conn)
+	for _, test := range tests {
+		m.Tap(test.dir, h, test.src, []byte("a\n"))
+
+		conn.SetReadDeadline(time.Now().Add(testTimeout))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read frame error - %v", err)
+		}
+		if !strings.HasSuffix(line, test.want+"\n") {
+			t.Errorf("Frame %q, want suffix %q", line, test.want)
+		}
+	}
+
+	conn.Close()
+	waitClients(t, m, 0)
+}
+
+// TestMonitorSlowClient checks frames to a monitor client which does not
+// read are dropped without blocking taps.
+func TestMonitorSlowClient(t *testing.T) {
+	m, addr := newTestMonitor(t, "?wqueue=1")
+	dialMonitor(t, m, addr, 1)
+	h := newTestSrc("src")
+
+	// Tap until socket buffers and the write queue are full
+	data := []byte(strings.Repeat("a", 64*1024))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 4096 && m.GetDrops() == 0; i++ {
+			m.Tap(res.RecordRead, h, nil, data)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * testTimeout):
+		t.Fatalf("Tap() is blocked by the slow client")
+	}
+	if m.GetDrops() == 0 {
+		t.Errorf("GetDrops() is 0, want dropped frames")
+	}
+}
+
+// TestMonitorClose checks monitor clients are disconnected by Close, and
+// Close can be called again.
+func TestMonitorClose(t *testing.T) {
+	m, addr := newTestMonitor(t, "")
+	conn := dialMonitor(t, m, addr, 1)
+
+	m.Close()
+	m.Close()
+
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Read() of the closed monitor client succeeded")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Errorf("Monitor client is not disconnected")
+	}
+}
+
+// TestMonitorHub checks data of clients is sent to monitor clients in hub
+// mode, which has no server resources.
+func TestMonitorHub(t *testing.T) {
+	s := newTestServer(t, HubOthers)
+	opt := "TCP:0"
+	format := MonitorText
+	m, err := s.NewMonitor(&opt, &format)
+	if err != nil {
+		t.Fatalf("NewMonitor() error - %v", err)
+	}
+	m.Run()
+	t.Cleanup(m.Close)
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run() error - %v", err)
+	}
+
+	monitor := dialMonitor(t, m, m.ln.ln.Addr().String(), 1)
+	conns := dialTestServer(t, s, 2)
+	conns[0].Write([]byte("a\n"))
+	expectConn(t, conns[1], "a\n")
+
+	// Data written to clients is not sent again
+	addr := conns[0].LocalAddr().(*net.TCPAddr)
+	want := fmt.Sprintf(` R CONN:TCP:%s:%d -> sbps "a\n"`, addr.IP, addr.Port)
+	reader := bufio.NewReader(monitor)
+	monitor.SetReadDeadline(time.Now().Add(testTimeout))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Read frame error - %v", err)
+	}
+	if !strings.HasSuffix(line, want+"\n") {
+		t.Errorf("Frame %q, want suffix %q", line, want)
+	}
+	if n := reader.Buffered(); n > 0 {
+		t.Errorf("Read %d bytes more, want nothing", n)
+	}
+	expectConn(t, monitor, "")
+}
@@ -1,8 +1,9 @@
 package server
 
 import (
+	"context"
 	"errors"
-	"os"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -11,6 +12,29 @@ import (
 	"github.com/ssup2/sbps/pkg/res"
 )
 
+// Hub modes.
+const (
+	HubNone   = "NONE"
+	HubAll    = "ALL"
+	HubOthers = "OTHERS"
+)
+
+// DrainInterval is the interval to check pending writes on shutdown.
+const DrainInterval = 50 * time.Millisecond
+
+// AcceptRetryInterval is the interval to retry accept after a temporary
+// error.
+const AcceptRetryInterval = 50 * time.Millisecond
+
+// ErrNoRes is error instance when the server runs without server resources.
+var ErrNoRes = errors.New("All server resources is closed")
+
+// Loggers with component fields.
+var (
+	sLog  = log.With(log.Fields{Component: log.CompServer})
+	lnLog = log.With(log.Fields{Component: log.CompListener})
+)
+
 // Server manages a server resource handler and a listen goroutine.
 type Server struct {
 	ln     *Listener
@@ -20,31 +44,57 @@ type Server struct {
 	lQuit chan struct{}
 	rQuit chan struct{}
 
+	mPing chan chan struct{}
+	lPing chan chan struct{}
+	rPing chan chan struct{}
+
+	lConns      chan net.Conn
+	lClosed     chan struct{}
+	lCloseOnce  *sync.Once
+	lAcceptOnce *sync.Once
+
 	resHLock     *sync.Mutex
 	sResInterval int
 	sResHs       map[*res.Handler]struct{}
 	sResClosedHs map[*res.Handler]struct{}
+	sResRetries  map[*res.Handler]int
+	sResMaxRetry int
 	sResHNoti    chan *res.Handler
 	cResHs       map[*res.Handler]struct{}
 	cResHNoti    chan *res.Handler
 
+	groupsLock *sync.Mutex
+	groups     map[string]*res.Group
+
+	hub     string
+	monitor *Monitor
+	minOpen int
+
+	hooks   []*Hook
+	hooksWg *sync.WaitGroup
+
+	interceptors []res.Interceptor
+
 	isRunLock *sync.Mutex
 	isRun     bool
+
+	done     chan struct{}
+	doneOnce *sync.Once
 }
 
 // New allocates and initialize a server instance.
 func New(optMode *string, optInterval int) (*Server, error) {
-	log.Infof("Allocate a server")
-
-	opts := strings.Split(*optMode, ":")
-	if len(opts) != 2 {
-		return nil, errors.New("Wrong server options")
-	}
-
-	ln, err := NewListener(&opts[0], &opts[1])
+	ln, err := ParseListener(optMode)
 	if err != nil {
 		return nil, err
 	}
+	return NewWithListener(ln, optInterval), nil
+}
+
+// NewWithListener allocates and initialize a server instance with the
+// listener of clients.
+func NewWithListener(ln *Listener, optInterval int) *Server {
+	sLog.Infof("Allocate a server")
 
 	return &Server{
 		ln:     ln,
@@ -54,17 +104,43 @@ func New(optMode *string, optInterval int) (*Server, error) {
 		lQuit: make(chan struct{}, 1),
 		rQuit: make(chan struct{}, 1),
 
+		mPing: make(chan chan struct{}),
+		lPing: make(chan chan struct{}),
+		rPing: make(chan chan struct{}),
+
+		lConns:      make(chan net.Conn),
+		lClosed:     make(chan struct{}),
+		lCloseOnce:  &sync.Once{},
+		lAcceptOnce: &sync.Once{},
+
 		resHLock:     &sync.Mutex{},
 		sResInterval: optInterval,
 		sResHs:       make(map[*res.Handler]struct{}),
 		sResClosedHs: make(map[*res.Handler]struct{}),
+		sResRetries:  make(map[*res.Handler]int),
+		sResMaxRetry: 0,
 		sResHNoti:    make(chan *res.Handler, 1),
 		cResHs:       make(map[*res.Handler]struct{}),
 		cResHNoti:    make(chan *res.Handler, 1),
 
+		groupsLock: &sync.Mutex{},
+		groups:     make(map[string]*res.Group),
+
+		hub:     HubNone,
+		monitor: nil,
+		minOpen: -1,
+
+		hooks:   nil,
+		hooksWg: &sync.WaitGroup{},
+
+		interceptors: nil,
+
 		isRunLock: &sync.Mutex{},
 		isRun:     false,
-	}, nil
+
+		done:     make(chan struct{}),
+		doneOnce: &sync.Once{},
+	}
 }
 
 // Close deinit and clean the server.
@@ -83,19 +159,18 @@ func (s *Server) Close() {
 	s.isRunLock.Unlock()
 
 	// Deinit
-	s.ln.ln.Close()
-	if s.sResInterval > 0 {
+	s.closeListener()
+	if s.ticker != nil {
 		s.ticker.Stop()
 	}
 
-	// Close server, client resource handlers
+	// Close server, client resource handlers and resources. Noti channels
+	// are not closed because closing handlers could send close events.
 	s.resHLock.Lock()
-	close(s.cResHNoti)
 	for sResH := range s.sResHs {
 		sResH.Stop()
 		sResH.Close()
 	}
-	close(s.sResHNoti)
 	for cResH := range s.cResHs {
 		cResH.Stop()
 		cResH.Close()
@@ -105,9 +180,72 @@ func (s *Server) Close() {
 	s.resHLock.Unlock()
 }
 
+// SetHub sets the hub mode. In hub mode, client writes are also
+// broadcast to the other clients, and to the sender in HubAll mode.
+func (s *Server) SetHub(hub *string) error {
+	switch *hub {
+	case HubNone, HubAll, HubOthers:
+	default:
+		return errors.New("Wrong hub mode")
+	}
+
+	s.hub = *hub
+	return nil
+}
+
+// isHub checks the server runs in hub mode.
+func (s *Server) isHub() bool {
+	return strings.Compare(s.hub, HubNone) != 0
+}
+
+// AddGroup append a server resource group.
+func (s *Server) AddGroup(g *res.Group) error {
+	sLog.Infof("Add the group - %s", *g.GetName())
+	s.groupsLock.Lock()
+	defer s.groupsLock.Unlock()
+
+	_, exist := s.groups[*g.GetName()]
+	if exist {
+		return errors.New("Group already exists")
+	}
+	s.groups[*g.GetName()] = g
+	return nil
+}
+
+// GetGroup returns the server resource group.
+func (s *Server) GetGroup(name *string) *res.Group {
+	s.groupsLock.Lock()
+	defer s.groupsLock.Unlock()
+
+	return s.groups[*name]
+}
+
+// AddInterceptor appends a global interceptor which is added to server and
+// client resource handlers. It must be added before resource handlers are
+// added.
+func (s *Server) AddInterceptor(i res.Interceptor) {
+	s.interceptors = append(s.interceptors, i)
+}
+
+// addInterceptors adds global interceptors to the resource handler.
+func (s *Server) addInterceptors(h *res.Handler) {
+	for _, i := range s.interceptors {
+		h.AddInterceptor(i)
+	}
+}
+
+// updateGroup updates the group of the server resource handler.
+func (s *Server) updateGroup(sResH *res.Handler) {
+	g := sResH.GetGroup()
+	if g != nil {
+		g.Update()
+	}
+}
+
 // AddSResHandler append a server resource handler.
 func (s *Server) AddSResHandler(sResH *res.Handler) {
-	log.Infof("Add the server resource - %s", *sResH.GetRes().GetInfo())
+	sLog.WithRes(*sResH.GetRes().GetInfo()).Infof("Add the server resource - %s",
+		*sResH.GetRes().GetInfo())
 	s.resHLock.Lock()
 	defer s.resHLock.Unlock()
 
@@ -116,17 +254,27 @@ func (s *Server) AddSResHandler(sResH *res.Handler) {
 		return
 	}
 	s.sResHs[sResH] = struct{}{}
+	if sResH.GetRes().IsOpen() {
+		s.fire(&Event{Type: EventResOpen, Res: *sResH.GetRes().GetInfo()})
+	}
+
+	s.addInterceptors(sResH)
+
+	// Tap all traffic of the server resource for monitor clients
+	if s.monitor != nil {
+		sResH.AddTap(s.monitor)
+	}
 
 	// Set write target handler for each handlers.
 	for cResH := range s.cResHs {
-		sResH.AddWriteTarget(cResH)
-		cResH.AddWriteTarget(sResH)
+		s.linkResH(sResH, cResH)
 	}
 }
 
 // RemoveSResHandler remove the server resource handler.
 func (s *Server) RemoveSResHandler(sResH *res.Handler) {
-	log.Infof("Remove the server resource - %s", *sResH.GetRes().GetInfo())
+	sLog.WithRes(*sResH.GetRes().GetInfo()).Infof("Remove the server resource - %s",
+		*sResH.GetRes().GetInfo())
 	s.resHLock.Lock()
 	defer s.resHLock.Unlock()
 
@@ -158,6 +306,7 @@ func (s *Server) AddSResClosedHandler(sResH *res.Handler) {
 		return
 	}
 	s.sResClosedHs[sResH] = struct{}{}
+	s.fire(&Event{Type: EventResClose, Res: *sResH.GetRes().GetInfo()})
 }
 
 // RemoveSResClosedHandler remove the server resource handler from closed handler map.
@@ -174,7 +323,7 @@ func (s *Server) RemoveSResClosedHandler(sResH *res.Handler) {
 
 // AddCResHandler append a client resource handler.
 func (s *Server) AddCResHandler(cResH *res.Handler) {
-	log.Infof("Add the client resource")
+	sLog.WithClient(*cResH.GetRes().GetInfo()).Infof("Add the client resource")
 	s.resHLock.Lock()
 	defer s.resHLock.Unlock()
 
@@ -183,25 +332,101 @@ func (s *Server) AddCResHandler(cResH *res.Handler) {
 		return
 	}
 	s.cResHs[cResH] = struct{}{}
+	s.addInterceptors(cResH)
+
+	// Tap data of the client for monitor clients, which includes data
+	// to other clients in hub mode and data without server resources
+	if s.monitor != nil {
+		cResH.AddTap(clientTap{m: s.monitor})
+	}
+	s.fire(&Event{Type: EventClientConnect, Client: *cResH.GetRes().GetInfo()})
 
 	// Set write target handler for each handlers.
 	for sResH := range s.sResHs {
-		sResH.AddWriteTarget(cResH)
-		cResH.AddWriteTarget(sResH)
+		s.linkResH(sResH, cResH)
+	}
+	s.linkHub(cResH)
+}
+
+// linkHub sets write target handlers between a client resource handler
+// and other client resource handlers in hub mode. A client resource bound
+// to a specific server resource is not linked.
+func (s *Server) linkHub(cResH *res.Handler) {
+	if !s.isHub() {
+		return
+	}
+
+	isBound := func(h *res.Handler) bool {
+		t, ok := h.GetRes().(res.Targeter)
+		return ok && t.GetTarget() != nil
+	}
+	if isBound(cResH) {
+		return
+	}
+
+	for other := range s.cResHs {
+		if other == cResH || isBound(other) {
+			continue
+		}
+		other.AddWriteTarget(cResH)
+		cResH.AddWriteTarget(other)
+	}
+
+	if strings.Compare(s.hub, HubAll) == 0 {
+		cResH.AddWriteTarget(cResH)
 	}
 }
 
 // RemoveCResHandler remove the client resource handler.
 func (s *Server) RemoveCResHandler(cResH *res.Handler) {
-	log.Infof("Remove the client resource")
+	sLog.WithClient(*cResH.GetRes().GetInfo()).Infof("Remove the client resource")
 	s.resHLock.Lock()
-	defer s.resHLock.Unlock()
-
 	_, exist := s.cResHs[cResH]
 	if !exist {
+		s.resHLock.Unlock()
 		return
 	}
 	delete(s.cResHs, cResH)
+	s.fire(&Event{Type: EventClientDisconn, Client: *cResH.GetRes().GetInfo()})
+
+	var sResHs []*res.Handler
+	for sResH := range s.sResHs {
+		sResHs = append(sResHs, sResH)
+	}
+	s.resHLock.Unlock()
+
+	// Release locks held by the client. Releasing notifies clients, so it
+	// is done without the lock.
+	for _, sResH := range sResHs {
+		sResH.ReleaseLock(cResH)
+	}
+}
+
+// linkResH sets write target handlers between a server resource handler
+// and a client resource handler. A client resource bound to a specific
+// server resource is only linked with the server resource.
+func (s *Server) linkResH(sResH *res.Handler, cResH *res.Handler) {
+	t, ok := cResH.GetRes().(res.Targeter)
+	if ok && t.GetTarget() != nil &&
+		strings.Compare(*t.GetTarget(), *sResH.GetRes().GetInfo()) != 0 {
+		return
+	}
+
+	sResH.AddWriteTarget(cResH)
+	cResH.AddWriteTarget(sResH)
+}
+
+// HasSRes checks the server resource exists.
+func (s *Server) HasSRes(info *string) bool {
+	s.resHLock.Lock()
+	defer s.resHLock.Unlock()
+
+	for sResH := range s.sResHs {
+		if strings.Compare(*info, *sResH.GetRes().GetInfo()) == 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // ReopenSResH try to reopen for closed SResHs
@@ -212,12 +437,12 @@ func (s *Server) ReopenSResH() {
 	for sResH := range s.sResClosedHs {
 		err := sResH.GetRes().Open()
 		if err == nil || err == res.ErrALO {
-			log.Infof("Reopen server resource - %s", *sResH.GetRes().GetInfo())
+			sLog.WithRes(*sResH.GetRes().GetInfo()).Infof("Reopen server resource - %s",
+				*sResH.GetRes().GetInfo())
 
 			// Set write target handler for each handlers.
 			for cResH := range s.cResHs {
-				sResH.AddWriteTarget(cResH)
-				cResH.AddWriteTarget(sResH)
+				s.linkResH(sResH, cResH)
 			}
 
 			_, exist := s.sResClosedHs[sResH]
@@ -225,28 +450,83 @@ func (s *Server) ReopenSResH() {
 				return
 			}
 			delete(s.sResClosedHs, sResH)
+			s.fire(&Event{Type: EventResReconnect, Res: *sResH.GetRes().GetInfo(),
+				Retries: s.sResRetries[sResH]})
+			delete(s.sResRetries, sResH)
 
 			sResH.Run()
+			s.updateGroup(sResH)
 		} else {
-			log.Debugf("Reopen server failed - %s", err.Error())
+			sLog.WithRes(*sResH.GetRes().GetInfo()).WithErr(err).Debugf(
+				"Reopen server failed - %s", err.Error())
+
+			// Give up the server resource if retries are exhausted
+			s.sResRetries[sResH]++
+			if s.sResMaxRetry > 0 && s.sResRetries[sResH] >= s.sResMaxRetry {
+				sLog.WithRes(*sResH.GetRes().GetInfo()).Warnf(
+					"Retries of server resource are exhausted - %s", *sResH.GetRes().GetInfo())
+				s.fire(&Event{Type: EventResExhausted, Res: *sResH.GetRes().GetInfo(),
+					Retries: s.sResRetries[sResH]})
+				delete(s.sResRetries, sResH)
+				delete(s.sResClosedHs, sResH)
+				delete(s.sResHs, sResH)
+
+				if len(s.sResHs) <= 0 && !s.isHub() {
+					sLog.Infof("All server resources is closed")
+					s.closeDone()
+				}
+			}
 		}
 	}
 }
 
-// AcceptCResH accept clients to commuicate SResHs
-func (s *Server) AcceptCResH() {
-	conn, err := s.ln.ln.Accept()
-	if err != nil {
-		if s.isRun == false {
-			log.Infof("Accept client failed - Close listener")
-		} else {
-			log.Errorf("Accept client failed - %s", err.Error())
+// accept accepts clients and sends them to the listen goroutine until the
+// listener is closed. It runs once for the server, so clients are accepted
+// by a goroutine across Stop and Run.
+func (s *Server) accept() {
+	defer close(s.lConns)
+	for {
+		conn, err := s.ln.ln.Accept()
+		if err != nil {
+			select {
+			case <-s.lClosed:
+				lnLog.Infof("Accept client failed - Close listener")
+				return
+			default:
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				lnLog.WithErr(err).Warnf("Accept client failed - %s", err.Error())
+				time.Sleep(AcceptRetryInterval)
+				continue
+			}
+			lnLog.WithErr(err).Errorf("Accept client failed - %s", err.Error())
+			return
+		}
+
+		select {
+		case s.lConns <- conn:
+		case <-s.lClosed:
+			conn.Close()
+			return
 		}
-		return
 	}
+}
+
+// closeListener closes the listener once.
+func (s *Server) closeListener() {
+	s.lCloseOnce.Do(func() {
+		close(s.lClosed)
+		s.ln.ln.Close()
+	})
+}
 
-	log.Infof("Accept the new client")
-	cResH := res.NewHandler(res.NewConn(&conn), s.cResHNoti)
+// AcceptCResH adds an accepted client to commuicate SResHs
+func (s *Server) AcceptCResH(conn *net.Conn) {
+	cResH := res.NewHandler(res.NewConn(conn), s.cResHNoti)
+	lnLog.WithClient(*cResH.GetRes().GetInfo()).Infof("Accept the new client")
+	cResH.EnableCtrl()
+	s.ln.SetCResOpts(cResH)
 	s.AddCResHandler(cResH)
 	cResH.Run()
 }
@@ -256,21 +536,35 @@ func (s *Server) GetSResHNoti() chan *res.Handler {
 	return s.sResHNoti
 }
 
-// Run start a listen goroutine.
-func (s *Server) Run() {
-	log.Infof("Run the server")
+// Done returns a channel which is closed when all server resources are
+// closed and not reopened.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// closeDone closes the done channel once.
+func (s *Server) closeDone() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Run start a listen goroutine. It returns ErrNoRes without server
+// resources except in hub mode.
+func (s *Server) Run() error {
+	sLog.Infof("Run the server")
 	s.isRunLock.Lock()
 	defer s.isRunLock.Unlock()
 
 	// Check
-	if len(s.sResHs) <= 0 {
-		log.Infof("Run failed - All server resources is closed")
-		os.Exit(1)
+	if len(s.sResHs) <= 0 && !s.isHub() {
+		sLog.Infof("Run failed - All server resources is closed")
+		return ErrNoRes
 	}
 
 	// Check running
 	if s.isRun == true {
-		return
+		return nil
 	}
 	s.isRun = true
 
@@ -281,14 +575,19 @@ func (s *Server) Run() {
 			case <-s.mQuit:
 				return
 
+			case pong := <-s.mPing:
+				close(pong)
+
 			case sResH := <-s.sResHNoti:
+				s.updateGroup(sResH)
 				if s.sResInterval > 0 {
 					s.AddSResClosedHandler(sResH)
 				} else {
+					s.fire(&Event{Type: EventResClose, Res: *sResH.GetRes().GetInfo()})
 					s.RemoveSResHandler(sResH)
-					if len(s.sResHs) <= 0 {
-						log.Infof("All server resources is closed")
-						os.Exit(0)
+					if len(s.sResHs) <= 0 && !s.isHub() {
+						sLog.Infof("All server resources is closed")
+						s.closeDone()
 					}
 				}
 
@@ -299,14 +598,23 @@ func (s *Server) Run() {
 	}()
 
 	// Listen goroutine
+	s.lAcceptOnce.Do(func() {
+		go s.accept()
+	})
 	go func() {
 		for {
 			select {
 			case <-s.lQuit:
 				return
 
-			default:
-				s.AcceptCResH()
+			case pong := <-s.lPing:
+				close(pong)
+
+			case conn, ok := <-s.lConns:
+				if !ok {
+					return
+				}
+				s.AcceptCResH(&conn)
 			}
 		}
 	}()
@@ -321,17 +629,78 @@ func (s *Server) Run() {
 				case <-s.rQuit:
 					return
 
+				case pong := <-s.rPing:
+					close(pong)
+
 				case <-s.ticker.C:
 					s.ReopenSResH()
 				}
 			}
 		}()
 	}
+	return nil
+}
+
+// Shutdown stops accepting clients, waits pending writes of resource
+// handlers and running hooks, and closes the server. If ctx is done before
+// draining, the server is closed immediately and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	sLog.Infof("Shutdown the server")
+
+	// Stop accepting clients. The listen goroutine stops after the
+	// listener is closed, and is signaled to quit by Close.
+	s.closeListener()
+
+	err := s.drain(ctx)
+	s.Close()
+	return err
+}
+
+// drain waits pending writes of resource handlers and running hooks.
+func (s *Server) drain(ctx context.Context) error {
+	ticker := time.NewTicker(DrainInterval)
+	defer ticker.Stop()
+
+	for s.getPending() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	hooksDone := make(chan struct{})
+	go func() {
+		s.WaitHooks()
+		close(hooksDone)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-hooksDone:
+		return nil
+	}
+}
+
+// getPending returns the number of pending writes of all resource handlers.
+func (s *Server) getPending() int32 {
+	s.resHLock.Lock()
+	defer s.resHLock.Unlock()
+
+	var pending int32
+	for sResH := range s.sResHs {
+		pending += sResH.GetPending()
+	}
+	for cResH := range s.cResHs {
+		pending += cResH.GetPending()
+	}
+	return pending
 }
 
 // Stop stops the server.
 func (s *Server) Stop() {
-	log.Infof("Stop the server")
+	sLog.Infof("Stop the server")
 	s.isRunLock.Lock()
 	defer s.isRunLock.Unlock()
 
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+// newTestServer allocates a server of the hub mode on a free TCP port. The
+// server is closed at the end of the test.
+func newTestServer(t *testing.T, hub string) *Server {
+	t.Helper()
+
+	opt := "TCP:0"
+	s, err := New(&opt, 0)
+	if err != nil {
+		t.Fatalf("New() error - %v", err)
+	}
+	if err := s.SetHub(&hub); err != nil {
+		t.Fatalf("SetHub() error - %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// runTestServer runs a server with a memory server resource, and returns
+// the server with the resource.
+func runTestServer(t *testing.T) (*Server, *res.Mem) {
+	t.Helper()
+
+	s := newTestServer(t, HubNone)
+	name := t.Name()
+	r := res.NewMem(&name, (1<<res.ModeR)|(1<<res.ModeW))
+	if err := r.Open(); err != nil {
+		t.Fatalf("Open() error - %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	sResH := res.NewHandler(r, s.GetSResHNoti())
+	s.AddSResHandler(sResH)
+	sResH.Run()
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run() error - %v", err)
+	}
+	return s, r
+}
+
+// dialTestServer dials clients to the server and waits until the server
+// has them.
+func dialTestServer(t *testing.T, s *Server, clients int) []net.Conn {
+	t.Helper()
+
+	var conns []net.Conn
+	for i := 0; i < clients; i++ {
+		conn, err := net.Dial("tcp", s.ln.ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial() error - %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conns = append(conns, conn)
+	}
+	waitCResHs(t, s, clients)
+	return conns
+}
+
+// TestShutdown checks clients and server resources are closed by Shutdown,
+// and clients hanging up after Shutdown are ignored.
+func TestShutdown(t *testing.T) {
+	s, r := runTestServer(t)
+	conns := dialTestServer(t, s, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error - %v", err)
+	}
+
+	if r.IsOpen() {
+		t.Errorf("Server resource is open after Shutdown()")
+	}
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(testTimeout))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("Read() of the client after Shutdown() is %v, want EOF", err)
+		}
+		conn.Close()
+	}
+
+	if _, err := net.Dial("tcp", s.ln.ln.Addr().String()); err == nil {
+		t.Errorf("Dial() after Shutdown() succeeded")
+	}
+}
+
+// TestCloseHangUp checks clients hanging up while the server is closed do
+// not block or panic.
+func TestCloseHangUp(t *testing.T) {
+	s, _ := runTestServer(t)
+	conns := dialTestServer(t, s, 16)
+
+	wg := &sync.WaitGroup{}
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+			conn.Close()
+		}(conn)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatalf("Close() is blocked by clients hanging up")
+	}
+
+	// Wait close events of clients sent after Close
+	time.Sleep(100 * time.Millisecond)
+}
+
+// expectConn checks data read from the connection is want, or nothing is
+// read if want is empty.
+func expectConn(t *testing.T, conn net.Conn, want string) {
+	t.Helper()
+
+	if want == "" {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if n, err := conn.Read(make([]byte, 16)); err == nil {
+			t.Errorf("Read %d bytes, want nothing", n)
+		}
+		return
+	}
+
+	got := make([]byte, len(want))
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("Read error - %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("Read %q, want %q", got, want)
+	}
+}
+
+// TestHub checks client writes are broadcast to clients by the hub mode
+// without server resources.
+func TestHub(t *testing.T) {
+	tests := []struct {
+		hub    string
+		sender string
+		other  string
+	}{
+		{hub: HubNone, sender: "", other: ""},
+		{hub: HubAll, sender: "a\n", other: "a\n"},
+		{hub: HubOthers, sender: "", other: "a\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hub, func(t *testing.T) {
+			s := newTestServer(t, test.hub)
+			err := s.Run()
+			if test.hub == HubNone {
+				if err != ErrNoRes {
+					t.Fatalf("Run() without server resources error - %v, want %v", err, ErrNoRes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error - %v", err)
+			}
+
+			conns := dialTestServer(t, s, 2)
+			conns[0].Write([]byte("a\n"))
+			expectConn(t, conns[1], test.other)
+			expectConn(t, conns[0], test.sender)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/ssup2/sbps/pkg/res"
+)
+
+// SResStatus represents status of a server resource.
+type SResStatus struct {
+	Info  string `json:"info"`
+	Open  bool   `json:"open"`
+	Group string `json:"group,omitempty"`
+}
+
+// Status represents status of a server.
+type Status struct {
+	SRess  []*SResStatus      `json:"resources"`
+	CRess  int                `json:"clients"`
+	Drops  int64              `json:"drops"`
+	Groups []*res.GroupStatus `json:"groups"`
+}
+
+// GetStatus returns status of the server.
+func (s *Server) GetStatus() *Status {
+	status := &Status{
+		SRess:  []*SResStatus{},
+		Groups: []*res.GroupStatus{},
+	}
+
+	s.resHLock.Lock()
+	for sResH := range s.sResHs {
+		sResStatus := &SResStatus{
+			Info: *sResH.GetRes().GetInfo(),
+			Open: sResH.GetRes().IsOpen(),
+		}
+		if sResH.GetGroup() != nil {
+			sResStatus.Group = *sResH.GetGroup().GetName()
+		}
+		status.SRess = append(status.SRess, sResStatus)
+	}
+	status.CRess = len(s.cResHs)
+	for cResH := range s.cResHs {
+		status.Drops += cResH.GetDrops()
+	}
+	s.resHLock.Unlock()
+
+	s.groupsLock.Lock()
+	for _, g := range s.groups {
+		status.Groups = append(status.Groups, g.GetStatus())
+	}
+	s.groupsLock.Unlock()
+
+	sort.Slice(status.SRess, func(i, j int) bool {
+		return status.SRess[i].Info < status.SRess[j].Info
+	})
+	sort.Slice(status.Groups, func(i, j int) bool {
+		return status.Groups[i].Name < status.Groups[j].Name
+	})
+	return status
+}